@@ -1,11 +1,48 @@
 package binary
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 )
 
+// The readers reject the lengths beyond these limits before allocating.
+// The dense slices grow with the input, while the zeros of the sparse and
+// varint slices take almost no input, so the codecs that know the length of
+// such a slice read it with the Len methods of Decoder.
+var (
+	MaxStringLen int64 = 1 << 20
+	MaxSliceLen  int64 = 1 << 27
+)
+
+// ErrCorrupt is wrapped by the errors of malformed input
+var ErrCorrupt = errors.New("corrupt binary data")
+
+// LengthError reports a length read from a stream that is negative or
+// exceeds its limit
+type LengthError struct {
+	Len int64
+	Max int64
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("binary: length %d out of range [0, %d]", e.Len, e.Max)
+}
+
+func (e *LengthError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// CheckLen returns a LengthError if n is negative or exceeds max
+func CheckLen(n, max int64) error {
+	if n < 0 || n > max {
+		return &LengthError{Len: n, Max: max}
+	}
+	return nil
+}
+
 func WriteUint16SliceSparse(w io.Writer, s []uint16) (int, error) {
 	var err error
 	var nn int
@@ -65,6 +102,13 @@ Return:
 }
 
 func ReadUint16SliceSparse(r io.Reader, s *[]uint16) (int, error) {
+	return readUint16SliceSparse(r, s, -1)
+}
+
+// readUint16SliceSparse reads a sparse slice of want elements, or of any
+// length if want is negative. The slice grows with the decoded runs and the
+// zeros after the last run are only allocated once the input is read.
+func readUint16SliceSparse(r io.Reader, s *[]uint16, want int64) (int, error) {
 	var err error
 	var nn int
 	n := 0
@@ -74,42 +118,88 @@ func ReadUint16SliceSparse(r io.Reader, s *[]uint16) (int, error) {
 	if err != nil {
 		return n, err
 	}
-	*s = make([]uint16, int(size))
+	if err := checkSliceLen(size, want); err != nil {
+		return n, err
+	}
+	a := []uint16{}
 	for {
 		var start int64
 		nn, err := ReadInt64(r, &start)
 		n += nn
-		if err == io.EOF {
-			goto Return
-		} else if err != nil {
-			return n, err
+		if err != nil {
+			return n, unexpectedEOF(err)
 		}
 		if start == 0 {
 			break
 		}
+		if start < 0 || start > size {
+			return n, fmt.Errorf("%w: sequence start %d out of range %d", ErrCorrupt, start, size)
+		}
 		start--
-		for i := start; ; i++ {
+		// a sequence reaching the end of the slice has no terminating zero,
+		// the end of the sparse array follows directly
+		for i := start; i < size; i++ {
 			var v uint16
 			nn, err := ReadUint16(r, &v)
 			n += nn
-			if err == io.EOF {
-				goto Return
-			} else if err != nil {
-				return n, err
+			if err != nil {
+				return n, unexpectedEOF(err)
 			}
 			if v == 0 {
 				break
 			}
-			if int(i) >= len(*s) {
-				return n, fmt.Errorf("out of range %d in %d", i, len(*s))
-			}
-			(*s)[i] = v
+			a = growUint16(a, int(i)+1)
+			a[i] = v
 		}
 	}
-Return:
+	*s = growUint16(a, int(size))
 	return n, nil
 }
 
+// checkSliceLen checks the length of a slice read from a stream against
+// MaxSliceLen and the expected length want unless it is negative
+func checkSliceLen(size, want int64) error {
+	if err := CheckLen(size, MaxSliceLen); err != nil {
+		return err
+	}
+	if want >= 0 && size != want {
+		return fmt.Errorf("%w: slice length %d, expect %d", ErrCorrupt, size, want)
+	}
+	return nil
+}
+
+// growUint16 extends a with zeros to at least n elements
+func growUint16(a []uint16, n int) []uint16 {
+	if n <= len(a) {
+		return a
+	}
+	return append(a, make([]uint16, n-len(a))...)
+}
+
+func growUint32(a []uint32, n int) []uint32 {
+	if n <= len(a) {
+		return a
+	}
+	return append(a, make([]uint32, n-len(a))...)
+}
+
+// minLen returns the initial capacity for a slice of size elements
+func minLen(size int64) int {
+	if size > 1<<16 {
+		return 1 << 16
+	}
+	return int(size)
+}
+
+// unexpectedEOF converts io.EOF in the middle of a value to
+// io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 func WriteString(w io.Writer, s string) (int, error) {
 	var err error
 	var nn int
@@ -137,16 +227,60 @@ func ReadString(r io.Reader, s *string) (int, error) {
 	if err != nil {
 		return n, err
 	}
+	if err := CheckLen(size, MaxStringLen); err != nil {
+		return n, err
+	}
 	buf := make([]byte, int(size))
 	nn, err = io.ReadFull(r, buf)
 	n += nn
 	if err != nil {
-		return n, err
+		return n, unexpectedEOF(err)
 	}
 	*s = string(buf)
 	return n, nil
 }
 
+func WriteUint8Slice(w io.Writer, s []uint8) (int, error) {
+	var err error
+	var nn int
+	n := 0
+	nn, err = WriteInt64(w, int64(len(s)))
+	n += nn
+	if err != nil {
+		return n, err
+	}
+	nn, err = w.Write(s)
+	n += nn
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func ReadUint8Slice(r io.Reader, s *[]uint8) (int, error) {
+	var err error
+	var nn int
+	n := 0
+	var size int64
+	nn, err = ReadInt64(r, &size)
+	n += nn
+	if err != nil {
+		return n, err
+	}
+	if err := CheckLen(size, MaxSliceLen); err != nil {
+		return n, err
+	}
+	// grow with the input instead of trusting size
+	buf := bytes.NewBuffer(make([]byte, 0, minLen(size)))
+	nn64, err := io.CopyN(buf, r, size)
+	n += int(nn64)
+	if err != nil {
+		return n, unexpectedEOF(err)
+	}
+	*s = buf.Bytes()
+	return n, nil
+}
+
 func WriteUint16Slice(w io.Writer, s []uint16) (int, error) {
 	var err error
 	var nn int
@@ -176,9 +310,34 @@ func ReadUint16Slice(r io.Reader, s *[]uint16) (int, error) {
 		return n, err
 	}
 	n += nn
-	*s = make([]uint16, int(size))
-	for i := range *s {
-		nn, err = ReadUint16(r, &(*s)[i])
+	if err := CheckLen(size, MaxSliceLen); err != nil {
+		return n, err
+	}
+	// grow with the input instead of trusting size
+	*s = make([]uint16, 0, minLen(size))
+	for i := int64(0); i < size; i++ {
+		var v uint16
+		nn, err = ReadUint16(r, &v)
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		n += nn
+		*s = append(*s, v)
+	}
+	return n, nil
+}
+
+func WriteUint32Slice(w io.Writer, s []uint32) (int, error) {
+	var err error
+	var nn int
+	n := 0
+	nn, err = WriteInt64(w, int64(len(s)))
+	if err != nil {
+		return n, err
+	}
+	n += nn
+	for _, v := range s {
+		nn, err = WriteUint32(w, v)
 		if err != nil {
 			return n, err
 		}
@@ -187,6 +346,37 @@ func ReadUint16Slice(r io.Reader, s *[]uint16) (int, error) {
 	return n, nil
 }
 
+func ReadUint32Slice(r io.Reader, s *[]uint32) (int, error) {
+	return readUint32Slice(r, s, -1)
+}
+
+func readUint32Slice(r io.Reader, s *[]uint32, want int64) (int, error) {
+	var err error
+	var nn int
+	n := 0
+	var size int64
+	nn, err = ReadInt64(r, &size)
+	if err != nil {
+		return n, err
+	}
+	n += nn
+	if err := checkSliceLen(size, want); err != nil {
+		return n, err
+	}
+	// grow with the input instead of trusting size
+	*s = make([]uint32, 0, minLen(size))
+	for i := int64(0); i < size; i++ {
+		var v uint32
+		nn, err = ReadUint32(r, &v)
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		n += nn
+		*s = append(*s, v)
+	}
+	return n, nil
+}
+
 func WriteUint64(w io.Writer, i uint64) (int, error) {
 	return w.Write([]byte{byte(i >> 56), byte(i >> 48), byte(i >> 40), byte(i >> 32),
 		byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
@@ -233,6 +423,20 @@ func ReadInt32(r io.Reader, i *int32) (int, error) {
 	return n, nil
 }
 
+func WriteUint32(w io.Writer, i uint32) (int, error) {
+	return w.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+}
+
+func ReadUint32(r io.Reader, i *uint32) (int, error) {
+	var b [4]byte
+	n, err := io.ReadFull(r, b[:])
+	if err != nil {
+		return n, err
+	}
+	*i = uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	return n, nil
+}
+
 func WriteFloat64(w io.Writer, f float64) (int, error) {
 	return WriteUint64(w, math.Float64bits(f))
 }
@@ -2,7 +2,10 @@ package binary
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -32,6 +35,9 @@ func TestSparse(t *testing.T) {
 		}
 		var s []uint16
 		n, err = ReadUint16SliceSparse(bytes.NewReader(bs), &s)
+		if err != nil {
+			t.Fatal(err, testcase)
+		}
 		if n != len(bs) {
 			t.Fatal("size mismatch", n, len(bs))
 		}
@@ -40,3 +46,122 @@ func TestSparse(t *testing.T) {
 		}
 	}
 }
+
+func TestLimits(t *testing.T) {
+	for _, size := range []int64{-1, MaxSliceLen + 1} {
+		var buf bytes.Buffer
+		WriteInt64(&buf, size)
+		var s []uint16
+		_, err := ReadUint16SliceSparse(bytes.NewReader(buf.Bytes()), &s)
+		var lerr *LengthError
+		if !errors.As(err, &lerr) || lerr.Len != size || !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("size %d: expect LengthError, got %v", size, err)
+		}
+	}
+
+	// a sequence starting beyond the slice
+	var buf bytes.Buffer
+	WriteInt64(&buf, 2)
+	WriteInt64(&buf, 3)
+	WriteUint16(&buf, 1)
+	var s []uint16
+	if _, err := ReadUint16SliceSparse(&buf, &s); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expect ErrCorrupt, got %v", err)
+	}
+
+	// a truncated dense slice claims more than it has
+	buf.Reset()
+	WriteInt64(&buf, 1<<20)
+	WriteUint16(&buf, 1)
+	if _, err := ReadUint16Slice(&buf, &s); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func FuzzReaders(f *testing.F) {
+	var buf bytes.Buffer
+	WriteUint16SliceSparse(&buf, []uint16{0, 1, 2, 0, 3})
+	WriteString(&buf, "key")
+	WriteUint8Slice(&buf, []uint8{1, 2})
+	WriteUint16Slice(&buf, []uint16{1, 2})
+	WriteUint32Slice(&buf, []uint32{1, 2})
+	WriteUint32SliceVarint(&buf, []uint32{0, 1, 0, 2})
+	f.Add(buf.Bytes())
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, read := range []func(io.Reader) (int, error){
+			func(r io.Reader) (int, error) { var s []uint16; return ReadUint16SliceSparse(r, &s) },
+			func(r io.Reader) (int, error) { var s string; return ReadString(r, &s) },
+			func(r io.Reader) (int, error) { var s []uint8; return ReadUint8Slice(r, &s) },
+			func(r io.Reader) (int, error) { var s []uint16; return ReadUint16Slice(r, &s) },
+			func(r io.Reader) (int, error) { var s []uint32; return ReadUint32Slice(r, &s) },
+			func(r io.Reader) (int, error) { var s []uint16; return ReadUint16SliceVarint(r, &s) },
+			func(r io.Reader) (int, error) { var s []uint32; return ReadUint32SliceVarint(r, &s) },
+			func(r io.Reader) (int, error) { var i uint64; return ReadUint64(r, &i) },
+			func(r io.Reader) (int, error) { var i int64; return ReadInt64(r, &i) },
+			func(r io.Reader) (int, error) { var i int32; return ReadInt32(r, &i) },
+			func(r io.Reader) (int, error) { var i uint32; return ReadUint32(r, &i) },
+			func(r io.Reader) (int, error) { var f float64; return ReadFloat64(r, &f) },
+			func(r io.Reader) (int, error) { var i uint16; return ReadUint16(r, &i) },
+			func(r io.Reader) (int, error) { var i uint8; return ReadUint8(r, &i) },
+		} {
+			if n, _ := read(bytes.NewReader(data)); n < 0 || n > len(data) {
+				t.Fatalf("read %d bytes of %d", n, len(data))
+			}
+		}
+	})
+}
+
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestHugeClaims(t *testing.T) {
+	claim := func(size int64, rest ...byte) []byte {
+		var buf bytes.Buffer
+		WriteInt64(&buf, size)
+		buf.Write(rest)
+		return buf.Bytes()
+	}
+	var varint bytes.Buffer
+	WriteUint32SliceVarint(&varint, []uint32{0, 1})
+	hugeVarint := append([]byte{0x80, 0x80, 0x80, 0x40}, varint.Bytes()[1:]...) // 1<<27 elements
+	for _, testcase := range []struct {
+		name string
+		read func() error
+	}{
+		{"truncated sparse", func() error {
+			var s []uint16
+			_, err := ReadUint16SliceSparse(bytes.NewReader(claim(MaxSliceLen, 0, 0, 0, 0)), &s)
+			return err
+		}},
+		{"truncated varint", func() error {
+			var s []uint16
+			_, err := ReadUint16SliceVarint(bytes.NewReader(hugeVarint[:len(hugeVarint)-1]), &s)
+			return err
+		}},
+		{"sparse length", func() error {
+			dec := NewDecoder(bytes.NewReader(claim(MaxSliceLen, 0, 0, 0, 0, 0, 0, 0, 0)))
+			dec.ReadUint16SliceSparseLen(16)
+			return dec.Err()
+		}},
+		{"varint length", func() error {
+			dec := NewDecoder(bytes.NewReader(hugeVarint))
+			dec.SetVarint(true)
+			dec.ReadUint32SliceLen(16)
+			return dec.Err()
+		}},
+	} {
+		var err error
+		if n := allocated(func() { err = testcase.read() }); n > 1<<20 {
+			t.Fatalf("%s: allocated %d bytes", testcase.name, n)
+		}
+		if err == nil {
+			t.Fatalf("%s: expect error", testcase.name)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package binary
+
+import (
+	"bufio"
+	"bytes"
+	stdbinary "encoding/binary"
+	"io"
+	"math"
+)
+
+// Encoder writes values in the format of the Write functions. It counts the
+// bytes written and keeps the first error, after which every write is
+// skipped, so a codec only checks the result of Flush.
+type Encoder struct {
+	w   io.Writer
+	buf *bufio.Writer // owned buffer, nil if w is already buffered
+	n   int64
+	err error
+
+	varint bool
+}
+
+// NewEncoder returns an Encoder that buffers its writes to w unless w is an
+// Encoder, a bufio.Writer or a bytes.Buffer. An Encoder writing to another
+// one inherits its varint mode.
+func NewEncoder(w io.Writer) *Encoder {
+	switch w := w.(type) {
+	case *Encoder:
+		return &Encoder{w: w, varint: w.varint}
+	case *bufio.Writer, *bytes.Buffer:
+		return &Encoder{w: w}
+	}
+	buf := bufio.NewWriter(w)
+	return &Encoder{w: buf, buf: buf}
+}
+
+// Write implements io.Writer so that nested codecs write through e
+func (e *Encoder) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	e.err = err
+	return n, err
+}
+
+func (e *Encoder) do(_ int, err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Flush flushes the owned buffer and returns the number of bytes written
+// and the first error
+func (e *Encoder) Flush() (int64, error) {
+	if e.buf != nil && e.err == nil {
+		e.err = e.buf.Flush()
+	}
+	return e.n, e.err
+}
+
+// Err returns the first error
+func (e *Encoder) Err() error { return e.err }
+
+// Fail records err unless an error was recorded before
+func (e *Encoder) Fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// SetVarint selects the varint encoding for the uint16 and uint32 slices,
+// they are written by the Varint functions instead of the fixed width ones
+func (e *Encoder) SetVarint(on bool) { e.varint = on }
+
+// Varint reports whether the varint encoding is selected, for the codecs
+// that pick their own varint encoding of other values
+func (e *Encoder) Varint() bool { return e.varint }
+
+// Encode writes v through e
+func (e *Encoder) Encode(v io.WriterTo) {
+	if e.err == nil {
+		_, err := v.WriteTo(e)
+		e.do(0, err)
+	}
+}
+
+func (e *Encoder) WriteInt64(v int64)   { e.do(WriteInt64(e, v)) }
+func (e *Encoder) WriteInt32(v int32)   { e.do(WriteInt32(e, v)) }
+func (e *Encoder) WriteUint64(v uint64) { e.do(WriteUint64(e, v)) }
+func (e *Encoder) WriteUint32(v uint32) { e.do(WriteUint32(e, v)) }
+func (e *Encoder) WriteUint16(v uint16) { e.do(WriteUint16(e, v)) }
+func (e *Encoder) WriteUint8(v uint8)   { e.do(WriteUint8(e, v)) }
+
+func (e *Encoder) WriteFloat64(v float64) { e.do(WriteFloat64(e, v)) }
+func (e *Encoder) WriteFloat32(v float32) { e.do(WriteUint32(e, math.Float32bits(v))) }
+
+func (e *Encoder) WriteString(s string) { e.do(WriteString(e, s)) }
+
+func (e *Encoder) WriteUint8Slice(s []uint8) { e.do(WriteUint8Slice(e, s)) }
+
+func (e *Encoder) WriteUint16Slice(s []uint16) {
+	if e.varint {
+		e.do(WriteUint16SliceVarint(e, s))
+		return
+	}
+	e.do(WriteUint16Slice(e, s))
+}
+
+func (e *Encoder) WriteUint16SliceSparse(s []uint16) {
+	if e.varint {
+		e.do(WriteUint16SliceVarint(e, s))
+		return
+	}
+	e.do(WriteUint16SliceSparse(e, s))
+}
+
+func (e *Encoder) WriteUint32Slice(s []uint32) {
+	if e.varint {
+		e.do(WriteUint32SliceVarint(e, s))
+		return
+	}
+	e.do(WriteUint32Slice(e, s))
+}
+
+// WriteUvarint writes v in 1 to 10 bytes, smaller values take fewer bytes
+func (e *Encoder) WriteUvarint(v uint64) {
+	var b [stdbinary.MaxVarintLen64]byte
+	e.do(e.Write(b[:stdbinary.PutUvarint(b[:], v)]))
+}
+
+// WriteVarint writes v zig-zag encoded in 1 to 10 bytes
+func (e *Encoder) WriteVarint(v int64) {
+	var b [stdbinary.MaxVarintLen64]byte
+	e.do(e.Write(b[:stdbinary.PutVarint(b[:], v)]))
+}
+
+// Decoder reads values in the format of the Read functions. It counts the
+// bytes read and keeps the first error, after which every read returns a
+// zero value. A Decoder never reads past the values it decodes, so an
+// unbuffered source should be wrapped in a bufio.Reader by the caller.
+type Decoder struct {
+	r   io.Reader
+	n   int64
+	err error
+
+	varint bool
+}
+
+// NewDecoder returns a Decoder reading from r. A Decoder reading from
+// another one inherits its varint mode.
+func NewDecoder(r io.Reader) *Decoder {
+	if r, ok := r.(*Decoder); ok {
+		return &Decoder{r: r, varint: r.varint}
+	}
+	return &Decoder{r: r}
+}
+
+// SetVarint selects the varint encoding for the uint16 and uint32 slices as
+// Encoder.SetVarint
+func (d *Decoder) SetVarint(on bool) { d.varint = on }
+
+// Varint reports whether the varint encoding is selected
+func (d *Decoder) Varint() bool { return d.varint }
+
+// Read implements io.Reader so that nested codecs read through d
+func (d *Decoder) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return n, err
+}
+
+// ReadByte implements io.ByteReader for the varint readers
+func (d *Decoder) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(d, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) do(_ int, err error) {
+	d.Fail(err)
+}
+
+// Result returns the number of bytes read and the first error
+func (d *Decoder) Result() (int64, error) {
+	return d.n, d.err
+}
+
+// Err returns the first error
+func (d *Decoder) Err() error { return d.err }
+
+// Fail records err unless an error was recorded before, it is meant for
+// the validation errors of a codec. io.EOF after some bytes were read is
+// recorded as io.ErrUnexpectedEOF, the input ended within a value.
+func (d *Decoder) Fail(err error) {
+	if d.err == nil {
+		if err == io.EOF && d.n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+	}
+}
+
+// Decode reads v through d
+func (d *Decoder) Decode(v io.ReaderFrom) {
+	if d.err == nil {
+		_, err := v.ReadFrom(d)
+		d.Fail(err)
+	}
+}
+
+func (d *Decoder) ReadInt64() (v int64) {
+	if d.err == nil {
+		d.do(ReadInt64(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadInt32() (v int32) {
+	if d.err == nil {
+		d.do(ReadInt32(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint64() (v uint64) {
+	if d.err == nil {
+		d.do(ReadUint64(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint32() (v uint32) {
+	if d.err == nil {
+		d.do(ReadUint32(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint16() (v uint16) {
+	if d.err == nil {
+		d.do(ReadUint16(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint8() (v uint8) {
+	if d.err == nil {
+		d.do(ReadUint8(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadFloat64() (v float64) {
+	if d.err == nil {
+		d.do(ReadFloat64(d, &v))
+	}
+	return
+}
+
+func (d *Decoder) ReadFloat32() float32 {
+	return math.Float32frombits(d.ReadUint32())
+}
+
+func (d *Decoder) ReadString() (s string) {
+	if d.err == nil {
+		d.do(ReadString(d, &s))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint8Slice() (s []uint8) {
+	if d.err == nil {
+		d.do(ReadUint8Slice(d, &s))
+	}
+	return
+}
+
+func (d *Decoder) ReadUint16Slice() (s []uint16) {
+	if d.err == nil {
+		if d.varint {
+			d.do(ReadUint16SliceVarint(d, &s))
+		} else {
+			d.do(ReadUint16Slice(d, &s))
+		}
+	}
+	return
+}
+
+func (d *Decoder) ReadUint16SliceSparse() (s []uint16) {
+	if d.err == nil {
+		if d.varint {
+			d.do(ReadUint16SliceVarint(d, &s))
+		} else {
+			d.do(ReadUint16SliceSparse(d, &s))
+		}
+	}
+	return
+}
+
+// ReadUint16SliceSparseLen is ReadUint16SliceSparse for a slice of n
+// elements, a different length fails before anything is allocated
+func (d *Decoder) ReadUint16SliceSparseLen(n int) (s []uint16) {
+	if d.err == nil {
+		if d.varint {
+			d.do(readUint16SliceVarint(d, &s, int64(n)))
+		} else {
+			d.do(readUint16SliceSparse(d, &s, int64(n)))
+		}
+	}
+	return
+}
+
+// ReadUint32SliceLen is ReadUint32Slice for a slice of n elements, a
+// different length fails before anything is allocated
+func (d *Decoder) ReadUint32SliceLen(n int) (s []uint32) {
+	if d.err == nil {
+		if d.varint {
+			d.do(readUint32SliceVarint(d, &s, int64(n)))
+		} else {
+			d.do(readUint32Slice(d, &s, int64(n)))
+		}
+	}
+	return
+}
+
+func (d *Decoder) ReadUint32Slice() (s []uint32) {
+	if d.err == nil {
+		if d.varint {
+			d.do(ReadUint32SliceVarint(d, &s))
+		} else {
+			d.do(ReadUint32Slice(d, &s))
+		}
+	}
+	return
+}
+
+func (d *Decoder) ReadUvarint() (v uint64) {
+	if d.err == nil {
+		var err error
+		v, err = stdbinary.ReadUvarint(d)
+		d.Fail(err)
+	}
+	return
+}
+
+func (d *Decoder) ReadVarint() (v int64) {
+	if d.err == nil {
+		var err error
+		v, err = stdbinary.ReadVarint(d)
+		d.Fail(err)
+	}
+	return
+}
@@ -0,0 +1,225 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderWire(t *testing.T) {
+	var expected bytes.Buffer
+	WriteInt64(&expected, -1)
+	WriteInt32(&expected, 2)
+	WriteUint64(&expected, 3)
+	WriteUint32(&expected, 4)
+	WriteUint16(&expected, 5)
+	WriteUint8(&expected, 6)
+	WriteFloat64(&expected, 7.5)
+	WriteString(&expected, "eight")
+	WriteUint8Slice(&expected, []uint8{9})
+	WriteUint16Slice(&expected, []uint16{10})
+	WriteUint16SliceSparse(&expected, []uint16{0, 11})
+	WriteUint32Slice(&expected, []uint32{12})
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.WriteInt64(-1)
+	enc.WriteInt32(2)
+	enc.WriteUint64(3)
+	enc.WriteUint32(4)
+	enc.WriteUint16(5)
+	enc.WriteUint8(6)
+	enc.WriteFloat64(7.5)
+	enc.WriteString("eight")
+	enc.WriteUint8Slice([]uint8{9})
+	enc.WriteUint16Slice([]uint16{10})
+	enc.WriteUint16SliceSparse([]uint16{0, 11})
+	enc.WriteUint32Slice([]uint32{12})
+	n, err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) || n != int64(buf.Len()) {
+		t.Fatalf("expect %x got %x (%d bytes)", expected.Bytes(), buf.Bytes(), n)
+	}
+
+	dec := NewDecoder(&buf)
+	if v := dec.ReadInt64(); v != -1 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadInt32(); v != 2 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint64(); v != 3 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint32(); v != 4 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint16(); v != 5 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint8(); v != 6 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadFloat64(); v != 7.5 {
+		t.Fatal(v)
+	}
+	if v := dec.ReadString(); v != "eight" {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint8Slice(); !reflect.DeepEqual(v, []uint8{9}) {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint16Slice(); !reflect.DeepEqual(v, []uint16{10}) {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint16SliceSparse(); !reflect.DeepEqual(v, []uint16{0, 11}) {
+		t.Fatal(v)
+	}
+	if v := dec.ReadUint32Slice(); !reflect.DeepEqual(v, []uint32{12}) {
+		t.Fatal(v)
+	}
+	if rn, err := dec.Result(); err != nil || rn != n {
+		t.Fatalf("read %d of %d bytes: %v", rn, n, err)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	uvalues := []uint64{0, 1, 127, 128, math.MaxUint64}
+	values := []int64{0, -1, 63, -64, math.MinInt64, math.MaxInt64}
+	for _, v := range uvalues {
+		enc.WriteUvarint(v)
+	}
+	for _, v := range values {
+		enc.WriteVarint(v)
+	}
+	enc.WriteFloat32(1.5)
+	n, err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(&buf)
+	for _, v := range uvalues {
+		if got := dec.ReadUvarint(); got != v {
+			t.Fatalf("expect %d got %d", v, got)
+		}
+	}
+	for _, v := range values {
+		if got := dec.ReadVarint(); got != v {
+			t.Fatalf("expect %d got %d", v, got)
+		}
+	}
+	if got := dec.ReadFloat32(); got != 1.5 {
+		t.Fatalf("expect 1.5 got %v", got)
+	}
+	if rn, err := dec.Result(); err != nil || rn != n {
+		t.Fatalf("read %d of %d bytes: %v", rn, n, err)
+	}
+}
+
+type limitWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		n, _ := l.w.Write(p[:l.n])
+		l.n = 0
+		return n, io.ErrShortWrite
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+func TestEncoderSticky(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&limitWriter{w: &buf, n: 10})
+	enc.WriteInt64(1)
+	enc.WriteInt64(2)
+	enc.WriteInt64(3)
+	n, err := enc.Flush()
+	if err != io.ErrShortWrite {
+		t.Fatalf("expect %v got %v", io.ErrShortWrite, err)
+	}
+	if buf.Len() != 10 {
+		t.Fatalf("expect 10 bytes written, got %d", buf.Len())
+	}
+	if n != 24 {
+		t.Fatalf("expect 24 bytes buffered, got %d", n)
+	}
+	enc.WriteInt64(4)
+	if _, err := enc.Flush(); err != io.ErrShortWrite {
+		t.Fatalf("expect the first error, got %v", err)
+	}
+}
+
+func TestDecoderSticky(t *testing.T) {
+	var buf bytes.Buffer
+	WriteInt64(&buf, 1)
+	WriteUint16(&buf, 2)
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.ReadInt64()
+	if v := dec.ReadInt64(); v != 0 {
+		t.Fatalf("expect zero value, got %d", v)
+	}
+	dec.ReadString()
+	n, err := dec.Result()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v got %v", io.ErrUnexpectedEOF, err)
+	}
+	if n != 10 {
+		t.Fatalf("expect 10 bytes read, got %d", n)
+	}
+	dec.Fail(errors.New("later"))
+	if dec.Err() != io.ErrUnexpectedEOF {
+		t.Fatalf("expect the first error, got %v", dec.Err())
+	}
+}
+
+type pair struct{ a, b int64 }
+
+func (p *pair) WriteTo(w io.Writer) (int64, error) {
+	enc := NewEncoder(w)
+	enc.WriteInt64(p.a)
+	enc.WriteVarint(p.b)
+	return enc.Flush()
+}
+
+func (p *pair) ReadFrom(r io.Reader) (int64, error) {
+	dec := NewDecoder(r)
+	p.a = dec.ReadInt64()
+	p.b = dec.ReadVarint()
+	return dec.Result()
+}
+
+func TestNested(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.WriteUint8(1)
+	enc.Encode(&pair{2, 3})
+	enc.Encode(&pair{4, 5})
+	n, err := enc.Flush()
+	if err != nil || n != int64(buf.Len()) || n != 1+2*9 {
+		t.Fatalf("wrote %d bytes of %d: %v", n, buf.Len(), err)
+	}
+	// the trailing byte is left to the next reader
+	buf.WriteByte(0xff)
+	dec := NewDecoder(&buf)
+	dec.ReadUint8()
+	var p, q pair
+	dec.Decode(&p)
+	dec.Decode(&q)
+	if rn, err := dec.Result(); err != nil || rn != n || p != (pair{2, 3}) || q != (pair{4, 5}) {
+		t.Fatalf("read %d bytes %v %v: %v", rn, p, q, err)
+	}
+	if buf.Len() != 1 {
+		t.Fatalf("expect 1 byte left, got %d", buf.Len())
+	}
+}
@@ -0,0 +1,156 @@
+package binary
+
+import (
+	stdbinary "encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+The varint encoding of an integer slice is
+
+	uvarint length
+	uvarint count of the nonzero elements
+	for each nonzero element:
+		uvarint number of zeros since the previous nonzero element
+		uvarint value
+
+which is compact for the sparse and mostly small counters of sketches.
+*/
+
+func WriteUint16SliceVarint(w io.Writer, s []uint16) (int, error) {
+	return writeSliceVarint(w, len(s), func(i int) uint64 { return uint64(s[i]) })
+}
+
+func ReadUint16SliceVarint(r io.Reader, s *[]uint16) (int, error) {
+	return readUint16SliceVarint(r, s, -1)
+}
+
+func readUint16SliceVarint(r io.Reader, s *[]uint16, want int64) (int, error) {
+	*s = []uint16{}
+	return readSliceVarint(r, math.MaxUint16, want,
+		func(n int) { *s = growUint16(*s, n) },
+		func(i int, v uint64) { (*s)[i] = uint16(v) })
+}
+
+func WriteUint32SliceVarint(w io.Writer, s []uint32) (int, error) {
+	return writeSliceVarint(w, len(s), func(i int) uint64 { return uint64(s[i]) })
+}
+
+func ReadUint32SliceVarint(r io.Reader, s *[]uint32) (int, error) {
+	return readUint32SliceVarint(r, s, -1)
+}
+
+func readUint32SliceVarint(r io.Reader, s *[]uint32, want int64) (int, error) {
+	*s = []uint32{}
+	return readSliceVarint(r, math.MaxUint32, want,
+		func(n int) { *s = growUint32(*s, n) },
+		func(i int, v uint64) { (*s)[i] = uint32(v) })
+}
+
+func writeSliceVarint(w io.Writer, size int, at func(int) uint64) (int, error) {
+	nonzero := 0
+	for i := 0; i < size; i++ {
+		if at(i) != 0 {
+			nonzero++
+		}
+	}
+	buf := make([]byte, 0, 4096+2*stdbinary.MaxVarintLen64)
+	buf = stdbinary.AppendUvarint(buf, uint64(size))
+	buf = stdbinary.AppendUvarint(buf, uint64(nonzero))
+	n := 0
+	prev := -1
+	for i := 0; i < size; i++ {
+		v := at(i)
+		if v == 0 {
+			continue
+		}
+		buf = stdbinary.AppendUvarint(buf, uint64(i-prev-1))
+		buf = stdbinary.AppendUvarint(buf, v)
+		prev = i
+		if len(buf) >= 4096 {
+			nn, err := w.Write(buf)
+			n += nn
+			if err != nil {
+				return n, err
+			}
+			buf = buf[:0]
+		}
+	}
+	nn, err := w.Write(buf)
+	n += nn
+	return n, err
+}
+
+// readSliceVarint reads a slice of want elements, or of any length if want
+// is negative. grow extends the slice with zeros to n elements, it follows
+// the decoded elements and the zeros after the last one are only allocated
+// once the input is read.
+func readSliceVarint(r io.Reader, max uint64, want int64, grow func(n int), set func(i int, v uint64)) (int, error) {
+	br := &byteCounter{r: r}
+	if b, ok := r.(io.ByteReader); ok {
+		br.br = b
+	}
+	size, err := stdbinary.ReadUvarint(br)
+	if err != nil {
+		return br.n, err
+	}
+	if size > uint64(MaxSliceLen) {
+		return br.n, &LengthError{Len: int64(size), Max: MaxSliceLen}
+	}
+	if err := checkSliceLen(int64(size), want); err != nil {
+		return br.n, err
+	}
+	nonzero, err := stdbinary.ReadUvarint(br)
+	if err != nil {
+		return br.n, unexpectedEOF(err)
+	}
+	if nonzero > size {
+		return br.n, fmt.Errorf("%w: %d nonzero elements in %d", ErrCorrupt, nonzero, size)
+	}
+	i := uint64(0)
+	for k := uint64(0); k < nonzero; k++ {
+		gap, err := stdbinary.ReadUvarint(br)
+		if err != nil {
+			return br.n, unexpectedEOF(err)
+		}
+		v, err := stdbinary.ReadUvarint(br)
+		if err != nil {
+			return br.n, unexpectedEOF(err)
+		}
+		if gap >= size-i {
+			return br.n, fmt.Errorf("%w: index out of range %d", ErrCorrupt, size)
+		}
+		i += gap
+		if v == 0 || v > max {
+			return br.n, fmt.Errorf("%w: element %d out of range [1, %d]", ErrCorrupt, v, max)
+		}
+		grow(int(i) + 1)
+		set(int(i), v)
+		i++
+	}
+	grow(int(size))
+	return br.n, nil
+}
+
+// byteCounter is an io.ByteReader counting the bytes read from r
+type byteCounter struct {
+	r  io.Reader
+	br io.ByteReader // r if it is an io.ByteReader
+	n  int
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	if c.br != nil {
+		b, err := c.br.ReadByte()
+		if err == nil {
+			c.n++
+		}
+		return b, err
+	}
+	var b [1]byte
+	n, err := io.ReadFull(c.r, b[:])
+	c.n += n
+	return b[0], err
+}
@@ -0,0 +1,101 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSliceVarint(t *testing.T) {
+	for _, testcase := range [][]uint32{
+		{},
+		{0},
+		{1},
+		{0, 0, 3},
+		{5, 0, 0, 0, 0, 300, math.MaxUint16},
+		{1, 2, 3, 0},
+	} {
+		var buf bytes.Buffer
+		s16 := make([]uint16, len(testcase))
+		for i, v := range testcase {
+			s16[i] = uint16(v)
+		}
+		wn, err := WriteUint16SliceVarint(&buf, s16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r16 []uint16
+		rn, err := ReadUint16SliceVarint(&buf, &r16)
+		if err != nil || rn != wn || !reflect.DeepEqual(r16, s16) {
+			t.Fatalf("expect %v got %v, read %d of %d bytes: %v", s16, r16, rn, wn, err)
+		}
+
+		wn, err = WriteUint32SliceVarint(&buf, testcase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r32 []uint32
+		rn, err = ReadUint32SliceVarint(&buf, &r32)
+		if err != nil || rn != wn || !reflect.DeepEqual(r32, testcase) {
+			t.Fatalf("expect %v got %v, read %d of %d bytes: %v", testcase, r32, rn, wn, err)
+		}
+	}
+}
+
+func TestSliceVarintCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	WriteUint32SliceVarint(&buf, []uint32{0, math.MaxUint16 + 1})
+	var s []uint16
+	if _, err := ReadUint16SliceVarint(bytes.NewReader(buf.Bytes()), &s); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expect %v got %v", ErrCorrupt, err)
+	}
+	// index beyond the length
+	if _, err := ReadUint16SliceVarint(bytes.NewReader([]byte{2, 1, 2, 1}), &s); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expect %v got %v", ErrCorrupt, err)
+	}
+	// more nonzero elements than the length
+	if _, err := ReadUint16SliceVarint(bytes.NewReader([]byte{1, 2}), &s); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expect %v got %v", ErrCorrupt, err)
+	}
+	if _, err := ReadUint16SliceVarint(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), &s); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestEncoderVarint(t *testing.T) {
+	s16 := []uint16{0, 0, 7, 0}
+	s32 := []uint32{9, 0}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetVarint(true)
+	// a nested encoder inherits the mode
+	nested := NewEncoder(enc)
+	nested.WriteUint16SliceSparse(s16)
+	nested.WriteUint16Slice(s16)
+	nested.WriteUint32Slice(s32)
+	n, err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3*4 {
+		t.Fatalf("expect %d bytes got %d", 3*4, n)
+	}
+	dec := NewDecoder(&buf)
+	dec.SetVarint(true)
+	nestedDec := NewDecoder(dec)
+	if v := nestedDec.ReadUint16SliceSparse(); !reflect.DeepEqual(v, s16) {
+		t.Fatal(v)
+	}
+	if v := nestedDec.ReadUint16Slice(); !reflect.DeepEqual(v, s16) {
+		t.Fatal(v)
+	}
+	if v := nestedDec.ReadUint32Slice(); !reflect.DeepEqual(v, s32) {
+		t.Fatal(v)
+	}
+	if rn, err := dec.Result(); err != nil || rn != n {
+		t.Fatalf("read %d of %d bytes: %v", rn, n, err)
+	}
+}
@@ -0,0 +1,44 @@
+// Command stats-collector pulls stats from the hosts in its config file and
+// exports them to the configured sinks until it receives SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"h12.io/stats/collector"
+	"h12.io/stats/statsutil"
+)
+
+func main() {
+	configFile := flag.String("config", "collector.json", "config file")
+	listen := flag.String("listen", "", "address to serve the self metrics of the collector, e.g. :8080")
+	flag.Parse()
+
+	cfg, err := collector.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := collector.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	if *listen != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(*listen, statsutil.Handler(c.Self, "/stats/")))
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := c.Run(ctx); err != nil {
+		log.Print(err)
+	}
+}
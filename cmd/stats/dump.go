@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"h12.io/stats"
+)
+
+func dumpCmd(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	width := fs.Int("width", 30, "number of seconds in the sparkline")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	for _, file := range fs.Args() {
+		s, err := readSnapshot(file)
+		if err != nil {
+			return err
+		}
+		_, to := timeRange(s)
+		if err := printTable(os.Stdout, s, to, *width); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printTable prints a row for every meter of s with the statistics of the
+// width seconds before end
+func printTable(w io.Writer, s *stats.S, end, width int) error {
+	if width < 1 {
+		width = 1
+	}
+	keys := make([]string, 0, len(s.Meters))
+	for key := range s.Meters {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTAGS\tSUM\tMAX\tLAST\tSERIES")
+	for _, key := range keys {
+		name, tags, err := stats.Key(key).Decode()
+		if err != nil {
+			return err
+		}
+		values := make([]int, width)
+		for i := range values {
+			values[i] = s.Meters[stats.Key(key)].Get(end - width + i)
+		}
+		sum, max := 0, 0
+		for _, v := range values {
+			sum += v
+			if v > max {
+				max = v
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n",
+			name, formatTags(tags), sum, max, values[len(values)-1], sparkline(values))
+	}
+	return tw.Flush()
+}
+
+func formatTags(tags stats.Tags) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + tags[k]
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func sparkline(values []int) string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	runes := make([]rune, len(values))
+	for i, v := range values {
+		switch {
+		case v <= 0:
+			runes[i] = ' '
+		default:
+			runes[i] = sparks[v*(len(sparks)-1)/max]
+		}
+	}
+	return string(runes)
+}
+
+func parseTags(s string) (stats.Tags, error) {
+	tags := make(stats.Tags)
+	if s == "" {
+		return tags, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tag %s", strconv.Quote(part))
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
@@ -0,0 +1,146 @@
+// Command stats pulls, dumps, merges and exports stats snapshots.
+//
+// Usage:
+//
+//	stats pull   [-timeout d] [-o file] hosts_file
+//	stats dump   [-width n] file...
+//	stats merge  [-o file] file...
+//	stats export -dsn dsn [-tags k=v,...] file...
+//	stats top    [-interval d] [-width n] (-hosts hosts_file | url...)
+//
+// A snapshot file is the JSON served by the vars route or the binary format
+// written by stats.S.WriteTo, "-" means stdin or stdout.
+//
+// A hosts file has one host per line in the form of "tag delay url...",
+// empty lines and lines starting with # are ignored.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/statsutil"
+)
+
+var commands = map[string]func(args []string) error{
+	"pull":   pullCmd,
+	"dump":   dumpCmd,
+	"merge":  mergeCmd,
+	"export": exportCmd,
+	"top":    topCmd,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: stats pull|dump|merge|export|top [flags] args...")
+	os.Exit(2)
+}
+
+func readHosts(file string) ([]statsutil.Host, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var hosts []statsutil.Host
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expect tag, delay and at least one URL", file, lineNum)
+		}
+		delay, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, lineNum, err)
+		}
+		hosts = append(hosts, statsutil.Host{
+			Tag:   fields[0],
+			Delay: delay,
+			URLs:  fields[2:],
+		})
+	}
+	return hosts, scanner.Err()
+}
+
+func readSnapshot(file string) (*stats.S, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
+	s := stats.New()
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if bytes.ContainsAny(first, " \t\r\n{") {
+		err = json.NewDecoder(br).Decode(s)
+	} else {
+		_, err = s.ReadFrom(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return s, nil
+}
+
+func writeSnapshot(file string, s *stats.S) error {
+	var w io.Writer = os.Stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return json.NewEncoder(w).Encode(s)
+}
+
+// timeRange returns the range of seconds covered by all meters of s
+func timeRange(s *stats.S) (from, to int) {
+	first := true
+	for _, meter := range s.Meters {
+		start, end := meter.Window()
+		if first || start < from {
+			from = start
+		}
+		if first || end > to {
+			to = end
+		}
+		first = false
+	}
+	return from, to
+}
+
+var errUsage = errors.New("invalid arguments")
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/statsutil"
+)
+
+func TestReadHosts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	text := "# comment\n\na 1s http://a/vars http://a2/vars\nb 0s http://b/vars\n"
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := readHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []statsutil.Host{
+		{Tag: "a", Delay: time.Second, URLs: []string{"http://a/vars", "http://a2/vars"}},
+		{Tag: "b", URLs: []string{"http://b/vars"}},
+	}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("expect %v got %v", expected, hosts)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if actual, expected := sparkline([]int{0, 1, 4, 8}), " ▁▄█"; actual != expected {
+		t.Fatalf("expect %q got %q", expected, actual)
+	}
+}
+
+func TestMergeSpan(t *testing.T) {
+	dir := t.TempDir()
+	a, b, out := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "out")
+	if err := os.WriteFile(a, []byte(`{"meters":{"m":[100,1,2]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte(`{"meters":{"m":[200,3]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeCmd([]string{"-max-span", "1m", "-o", out, a, b}); err == nil {
+		t.Fatal("expect error of a span exceeding -max-span")
+	}
+	if err := mergeCmd([]string{"-o", out, a, b}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readSnapshot(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.Meters[stats.NewKey("m", nil)]
+	if m == nil || m.Get(101) != 2 || m.Get(200) != 3 {
+		t.Fatalf("unexpected merged snapshot %v", s)
+	}
+
+	var buf bytes.Buffer
+	if err := printTable(&buf, s, 201, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "m ") {
+		t.Fatalf("expect a row of m, got %q", buf.String())
+	}
+}
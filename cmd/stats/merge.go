@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"h12.io/stats"
+)
+
+func mergeCmd(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("o", "-", "output file")
+	maxSpan := fs.Duration("max-span", 24*time.Hour, "maximum time span of the merged snapshots")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	snapshots := make([]*stats.S, fs.NArg())
+	var from, to int
+	for i, file := range fs.Args() {
+		s, err := readSnapshot(file)
+		if err != nil {
+			return err
+		}
+		snapshots[i] = s
+		f, t := timeRange(s)
+		if i == 0 || f < from {
+			from = f
+		}
+		if i == 0 || t > to {
+			to = t
+		}
+	}
+	// make the merged meters wide enough to hold every snapshot, one int per
+	// second
+	if span := time.Duration(to-from) * time.Second; span > *maxSpan {
+		return fmt.Errorf("snapshots span %v, exceeding -max-span %v", span, *maxSpan)
+	}
+	merged := stats.New().SetBufSize(to - from)
+	for _, s := range snapshots {
+		merged.Merge(s, time.Unix(int64(from), 0))
+	}
+	return writeSnapshot(*out, merged)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/statsutil"
+)
+
+func pullCmd(args []string) error {
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "HTTP timeout")
+	out := fs.String("o", "-", "output file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	hosts, err := readHosts(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	s, err := pull(&http.Client{Timeout: *timeout}, hosts)
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(*out, s)
+}
+
+func pull(client *http.Client, hosts []statsutil.Host) (*stats.S, error) {
+	start := time.Now().Add(-time.Duration(stats.DefaultBufferSize) * time.Second)
+	return statsutil.CollectStats(client, hosts, start)
+}
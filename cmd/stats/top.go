@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"h12.io/stats/statsutil"
+)
+
+func topCmd(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	hostsFile := fs.String("hosts", "", "hosts file")
+	interval := fs.Duration("interval", time.Second, "refresh interval")
+	width := fs.Int("width", 40, "number of seconds in the sparkline")
+	timeout := fs.Duration("timeout", 5*time.Second, "HTTP timeout")
+	fs.Parse(args)
+
+	var hosts []statsutil.Host
+	if *hostsFile != "" {
+		var err error
+		if hosts, err = readHosts(*hostsFile); err != nil {
+			return err
+		}
+	}
+	for i, uri := range fs.Args() {
+		hosts = append(hosts, statsutil.Host{Tag: strconv.Itoa(i), URLs: []string{uri}})
+	}
+	if len(hosts) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		s, err := pull(client, hosts)
+		fmt.Print("\033[H\033[2J") // move home and clear screen
+		fmt.Println(time.Now().Format(time.RFC3339))
+		if err != nil {
+			fmt.Println(err)
+		} else if err := printTable(os.Stdout, s, int(time.Now().Unix()), *width); err != nil {
+			return err
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,302 @@
+// Package collector periodically pulls stats from hosts and exports the
+// completed seconds to sinks.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/statsutil"
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = 5 * time.Second
+	DefaultLag      = time.Second
+	DefaultMaxSkew  = time.Second
+)
+
+// Collector pulls stats from Hosts every Interval, aligned to multiples of
+// Interval, and exports the seconds completed since the last export to Sinks.
+// The latest Lag of seconds are left to the next export because hosts may
+// still be counting them. The seconds of a host that fails are exported
+// after it recovers, as long as they are still within its meter buffer.
+type Collector struct {
+	Client    *http.Client
+	Hosts     []statsutil.Host
+	Discovery Discovery // provides hosts in addition to Hosts if not nil
+	Interval  time.Duration
+	Lag       time.Duration
+	MaxSkew   time.Duration // a warning is logged when a host's clock skew exceeds it
+	Tags      stats.Tags
+	Sinks     []Sink
+	Logger    *log.Logger
+
+	// Self holds the metrics about the collector itself, they are exported
+	// together with the collected stats
+	Self *stats.S
+
+	last     time.Time            // end of the last export of Self
+	hostLast map[string]time.Time // end of the last export by host tag
+	mu       sync.Mutex
+}
+
+// bufferDuration is the time covered by the meters of a host
+var bufferDuration = time.Duration(stats.DefaultBufferSize) * time.Second
+
+// New creates a collector from cfg and opens its sinks
+func New(cfg *Config) (*Collector, error) {
+	c := &Collector{
+		Client:   &http.Client{Timeout: cfg.Timeout.Duration},
+		Interval: cfg.Interval.Duration,
+		Lag:      cfg.Lag.Duration,
+		MaxSkew:  cfg.MaxSkew.Duration,
+		Tags:     cfg.Tags,
+		Logger:   log.Default(),
+		Self:     stats.New(),
+	}
+	if c.Client.Timeout == 0 {
+		c.Client.Timeout = DefaultTimeout
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Lag == 0 {
+		c.Lag = DefaultLag
+	}
+	if c.MaxSkew == 0 {
+		c.MaxSkew = DefaultMaxSkew
+	}
+	if c.Interval+c.Lag > bufferDuration {
+		return nil, fmt.Errorf("interval %v plus lag %v exceeds the meter buffer of %v", c.Interval, c.Lag, bufferDuration)
+	}
+	for i := range cfg.Hosts {
+		c.Hosts = append(c.Hosts, cfg.Hosts[i].host())
+	}
+	if cfg.HostPath != "" {
+		d := NewFileDiscovery(cfg.HostPath)
+		if _, err := d.Reload(); err != nil {
+			return nil, err
+		}
+		c.Discovery = d
+	}
+	for _, dsn := range cfg.Sinks {
+		sink, err := OpenSink(dsn)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.Sinks = append(c.Sinks, sink)
+	}
+	return c, nil
+}
+
+// Run collects on every aligned tick until ctx is done, then flushes the
+// last completed seconds before returning
+func (c *Collector) Run(ctx context.Context) error {
+	if c.Discovery != nil {
+		go c.Discovery.Watch(ctx)
+	}
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(c.Interval).Add(c.Interval).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return c.collect(time.Now().Truncate(time.Second))
+		case now := <-timer.C:
+			if err := c.Collect(now); err != nil {
+				c.Logger.Print(err)
+			}
+		}
+	}
+}
+
+// Collect pulls all hosts and exports the seconds completed before now-Lag
+func (c *Collector) Collect(now time.Time) error {
+	return c.collect(now.Add(-c.Lag).Truncate(time.Second))
+}
+
+// window is the stats exported for the same range of seconds
+type window struct {
+	from  time.Time
+	s     *stats.S
+	hosts []string
+	self  bool
+}
+
+func (c *Collector) collect(end time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hostStats, scrapeErr := c.scrape(end)
+
+	windows := make(map[int64]*window)
+	add := func(last time.Time, s *stats.S) *window {
+		from := last
+		if from.IsZero() {
+			from = end.Add(-c.Interval)
+		}
+		if min := end.Add(-bufferDuration); from.Before(min) {
+			from = min
+		}
+		if !end.After(from) {
+			return nil
+		}
+		w, ok := windows[from.UnixNano()]
+		if !ok {
+			w = &window{from: from, s: stats.New()}
+			windows[from.UnixNano()] = w
+		}
+		// the sinks save the seconds within the window
+		w.s.Merge(s, end.Add(-bufferDuration))
+		return w
+	}
+	if c.hostLast == nil {
+		c.hostLast = make(map[string]time.Time)
+	}
+	for tag, s := range hostStats {
+		if w := add(c.hostLast[tag], s); w != nil {
+			w.hosts = append(w.hosts, tag)
+		}
+	}
+	if w := add(c.last, c.Self); w != nil {
+		w.self = true
+	}
+
+	sorted := make([]*window, 0, len(windows))
+	for _, w := range windows {
+		sorted = append(sorted, w)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].from.Before(sorted[j].from) })
+	var errs []string
+	for _, w := range sorted {
+		if err := c.export(w.s, w.from, end); err != nil {
+			// keep the last ends so that the same seconds are exported
+			// again
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, tag := range w.hosts {
+			c.hostLast[tag] = end
+		}
+		if w.self {
+			c.last = end
+		}
+	}
+	c.forgetHosts()
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return scrapeErr
+}
+
+func (c *Collector) export(s *stats.S, from, end time.Time) error {
+	var errs []string
+	for _, sink := range c.Sinks {
+		if err := sink.SaveStats(s, from, end.Sub(from), c.Tags); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// forgetHosts drops the last export of the hosts that are gone
+func (c *Collector) forgetHosts() {
+	current := make(map[string]bool)
+	for _, host := range c.hosts() {
+		current[host.Tag] = true
+	}
+	for tag := range c.hostLast {
+		if !current[tag] {
+			delete(c.hostLast, tag)
+		}
+	}
+}
+
+// scrape pulls every host separately so that a failing host does not affect
+// the others and is counted in the self metrics, the stats are returned by
+// the tags of the hosts that succeeded
+func (c *Collector) scrape(now time.Time) (map[string]*stats.S, error) {
+	start := now.Add(-bufferDuration)
+	all := make(map[string]*stats.S)
+	var (
+		wg   sync.WaitGroup
+		errs []string
+		mu   sync.Mutex
+	)
+	for _, host := range c.hosts() {
+		host := host
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			begin := time.Now()
+			hosts := []statsutil.Host{host}
+			s, err := statsutil.CollectStats(c.Client, hosts, start)
+			c.record(host.Tag, time.Since(begin), hosts[0].Skew, err)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, host.Tag+": "+err.Error())
+				return
+			}
+			if other, ok := all[host.Tag]; ok {
+				other.Merge(s, start)
+				return
+			}
+			all[host.Tag] = s
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return all, errors.New(strings.Join(errs, "; "))
+	}
+	return all, nil
+}
+
+func (c *Collector) hosts() []statsutil.Host {
+	if c.Discovery == nil {
+		return c.Hosts
+	}
+	return append(c.Hosts[:len(c.Hosts):len(c.Hosts)], c.Discovery.Hosts()...)
+}
+
+func (c *Collector) record(host string, du, skew time.Duration, err error) {
+	now := time.Now()
+	tags := stats.Tags{"host": host}
+	c.Self.Meter("collector.scrapes", tags).Inc(now, 1)
+	c.Self.Meter("collector.scrape_duration_ms", tags).Inc(now, int(du/time.Millisecond))
+	if err != nil {
+		c.Self.Meter("collector.scrape_failures", tags).Inc(now, 1)
+		return
+	}
+	c.Self.Meter("collector.clock_skew_ms", tags).Inc(now, int(skew/time.Millisecond))
+	if c.MaxSkew > 0 && (skew > c.MaxSkew || skew < -c.MaxSkew) {
+		c.Logger.Printf("clock skew of host %s is %v, exceeding %v", host, skew, c.MaxSkew)
+	}
+}
+
+// Close closes all sinks
+func (c *Collector) Close() error {
+	var errs []string
+	for _, sink := range c.Sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/statsutil"
+)
+
+type testSink struct {
+	saved []*stats.S
+	froms []time.Time
+	dus   []time.Duration
+}
+
+func (s *testSink) SaveStats(st *stats.S, from time.Time, du time.Duration, tags map[string]string) error {
+	s.saved = append(s.saved, st)
+	s.froms = append(s.froms, from)
+	s.dus = append(s.dus, du)
+	return nil
+}
+
+func (s *testSink) Close() error { return nil }
+
+func TestCollect(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	source := stats.New()
+	source.Meter("test", nil).Inc(now, 1)
+	server := httptest.NewServer(statsutil.Handler(source, "/"))
+	defer server.Close()
+
+	sink := &testSink{}
+	c := &Collector{
+		Client: http.DefaultClient,
+		Hosts: []statsutil.Host{
+			{Tag: "a", URLs: []string{server.URL + "/vars"}},
+			{Tag: "b", URLs: []string{server.URL + "/missing"}},
+		},
+		Interval: time.Second,
+		Sinks:    []Sink{sink},
+		Self:     stats.New(),
+	}
+	if err := c.Collect(now.Add(2 * time.Second)); err == nil {
+		t.Fatal("expect error from host b")
+	}
+	if len(sink.saved) != 1 {
+		t.Fatalf("expect 1 export got %d", len(sink.saved))
+	}
+	if !sink.froms[0].Equal(now.Add(time.Second)) || sink.dus[0] != time.Second {
+		t.Fatalf("unexpected window %v %v", sink.froms[0], sink.dus[0])
+	}
+	s := sink.saved[0]
+	if meter, ok := s.Meters[stats.NewKey("test", stats.Tags{"host": "a"})]; !ok || meter.Get(int(now.Unix())) != 1 {
+		t.Fatalf("collected stats not found in %v", s)
+	}
+	if _, ok := s.Meters[stats.NewKey("collector.scrape_failures", stats.Tags{"host": "b"})]; !ok {
+		t.Fatalf("failure metric not found in %v", s)
+	}
+
+	c.last = now.Add(-time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Run(ctx); err == nil {
+		t.Fatal("expect error from host b")
+	}
+	if len(sink.saved) != 2 || !sink.froms[1].Equal(now.Add(-time.Second)) {
+		t.Fatalf("expect flush from %v got %v", now.Add(-time.Second), sink.froms)
+	}
+}
+
+func TestCollectRecovered(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	source := stats.New()
+	source.Meter("test", nil).Inc(now, 1)
+	server := httptest.NewServer(statsutil.Handler(source, "/"))
+	defer server.Close()
+
+	sink := &testSink{}
+	c := &Collector{
+		Client: http.DefaultClient,
+		Hosts: []statsutil.Host{
+			{Tag: "a", URLs: []string{server.URL + "/vars"}},
+			{Tag: "b", URLs: []string{server.URL + "/vars"}},
+		},
+		Interval: time.Second,
+		Sinks:    []Sink{sink},
+		Self:     stats.New(),
+	}
+	if err := c.Collect(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	c.Hosts[1].URLs = []string{server.URL + "/missing"}
+	if err := c.Collect(now.Add(2 * time.Second)); err == nil {
+		t.Fatal("expect error from host b")
+	}
+	c.Hosts[1].URLs = []string{server.URL + "/vars"}
+	if err := c.Collect(now.Add(3 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// b exports the second it missed together with the current one
+	if len(sink.saved) != 4 {
+		t.Fatalf("expect 4 exports got %d", len(sink.saved))
+	}
+	keyB := stats.NewKey("test", stats.Tags{"host": "b"})
+	if _, ok := sink.saved[1].Meters[keyB]; ok {
+		t.Fatal("unexpected export of b while failing")
+	}
+	if !sink.froms[2].Equal(now.Add(time.Second)) || sink.dus[2] != 2*time.Second {
+		t.Fatalf("unexpected window of b %v %v", sink.froms[2], sink.dus[2])
+	}
+	if _, ok := sink.saved[2].Meters[keyB]; !ok {
+		t.Fatalf("stats of b not found in %v", sink.saved[2])
+	}
+	if !sink.froms[3].Equal(now.Add(2*time.Second)) || sink.dus[3] != time.Second {
+		t.Fatalf("unexpected window of a %v %v", sink.froms[3], sink.dus[3])
+	}
+}
+
+func TestNewInterval(t *testing.T) {
+	cfg := &Config{Interval: Duration{time.Minute}}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expect error of an interval beyond the meter buffer")
+	}
+}
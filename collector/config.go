@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"h12.io/stats/statsutil"
+)
+
+// Config is the JSON config file of a collector, e.g.
+//
+//	{
+//		"interval": "10s",
+//		"hosts": [{"tag": "a", "urls": ["http://a:8080/stats/vars"], "delay": "1s"}],
+//		"tags": {"dc": "sg"},
+//		"sinks": ["http://localhost:8086/stats"]
+//	}
+type Config struct {
+	Interval Duration          `json:"interval"`
+	Timeout  Duration          `json:"timeout"`
+	Lag      Duration          `json:"lag"`
+	MaxSkew  Duration          `json:"max_skew"`
+	Hosts    []HostConfig      `json:"hosts"`
+	HostPath string            `json:"host_path"` // file or directory watched by FileDiscovery
+	Tags     map[string]string `json:"tags"`
+	Sinks    []string          `json:"sinks"`
+}
+
+type HostConfig struct {
+	Tag          string                  `json:"tag" yaml:"tag"`
+	URLs         []string                `json:"urls" yaml:"urls"`
+	Delay        Duration                `json:"delay" yaml:"delay"`
+	Tags         map[string]string       `json:"tags" yaml:"tags"`
+	DiscoverTags bool                    `json:"discover_tags" yaml:"discover_tags"`
+	Relabel      []statsutil.RelabelRule `json:"relabel" yaml:"relabel"`
+}
+
+// Duration is a time.Duration in the form of "1m30s" in JSON
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func LoadConfig(file string) (*Config, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (h *HostConfig) host() statsutil.Host {
+	return statsutil.Host{
+		URLs:         h.URLs,
+		Tag:          h.Tag,
+		Delay:        h.Delay.Duration,
+		Tags:         h.Tags,
+		DiscoverTags: h.DiscoverTags,
+		Relabel:      h.Relabel,
+	}
+}
@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"h12.io/stats/statsutil"
+)
+
+const DefaultDiscoveryInterval = 5 * time.Second
+
+// Discovery provides the current set of hosts to a collector
+type Discovery interface {
+	Hosts() []statsutil.Host
+	Watch(ctx context.Context)
+}
+
+// FileDiscovery reads hosts from a JSON or YAML file, or from all such files
+// in a directory, and reloads them when the files change. Each file contains
+// a list of HostConfig, the format is decided by the file extension.
+type FileDiscovery struct {
+	Path     string
+	Interval time.Duration
+	Logger   *log.Logger
+
+	hosts     []statsutil.Host
+	signature string
+	mu        sync.RWMutex
+}
+
+func NewFileDiscovery(path string) *FileDiscovery {
+	return &FileDiscovery{
+		Path:     path,
+		Interval: DefaultDiscoveryInterval,
+		Logger:   log.Default(),
+	}
+}
+
+// Hosts returns the hosts loaded most recently
+func (d *FileDiscovery) Hosts() []statsutil.Host {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.hosts
+}
+
+// Watch polls the files every Interval and reloads them when changed until
+// ctx is done, the previous hosts are kept if the files cannot be loaded
+func (d *FileDiscovery) Watch(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Reload(); err != nil {
+				d.Logger.Print(err)
+			}
+		}
+	}
+}
+
+// Reload loads the files if they have changed since the last load
+func (d *FileDiscovery) Reload() (changed bool, err error) {
+	files, signature, err := d.files()
+	if err != nil {
+		return false, err
+	}
+	d.mu.RLock()
+	unchanged := signature == d.signature
+	d.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	var hosts []statsutil.Host
+	for _, file := range files {
+		configs, err := readHostFile(file)
+		if err != nil {
+			return false, err
+		}
+		for i := range configs {
+			hosts = append(hosts, configs[i].host())
+		}
+	}
+	d.mu.Lock()
+	d.hosts = hosts
+	d.signature = signature
+	d.mu.Unlock()
+	return true, nil
+}
+
+// files returns the host files under Path and a signature that changes
+// when any of them is added, removed or modified
+func (d *FileDiscovery) files() ([]string, string, error) {
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	files := []string{d.Path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(d.Path)
+		if err != nil {
+			return nil, "", err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() && hostFileFormat(entry.Name()) != "" {
+				files = append(files, filepath.Join(d.Path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+	var signature strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(&signature, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return files, signature.String(), nil
+}
+
+func hostFileFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return ""
+}
+
+func readHostFile(file string) ([]HostConfig, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []HostConfig
+	if hostFileFormat(file) == "yaml" {
+		err = yaml.UnmarshalStrict(buf, &hosts)
+	} else {
+		err = json.Unmarshal(buf, &hosts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return hosts, nil
+}
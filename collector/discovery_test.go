@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"h12.io/stats/statsutil"
+)
+
+func TestFileDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("a.json", `[{"tag": "a", "urls": ["http://a/vars"], "delay": "1s"}]`)
+	writeFile("b.yaml", "- tag: b\n  urls: [http://b/vars]\n  delay: 2s\n")
+	writeFile("ignored.txt", "x")
+
+	d := NewFileDiscovery(dir)
+	if changed, err := d.Reload(); err != nil || !changed {
+		t.Fatal(changed, err)
+	}
+	expected := []statsutil.Host{
+		{Tag: "a", URLs: []string{"http://a/vars"}, Delay: time.Second},
+		{Tag: "b", URLs: []string{"http://b/vars"}, Delay: 2 * time.Second},
+	}
+	if !reflect.DeepEqual(d.Hosts(), expected) {
+		t.Fatalf("expect %v got %v", expected, d.Hosts())
+	}
+	if changed, err := d.Reload(); err != nil || changed {
+		t.Fatal(changed, err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.json")); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := d.Reload(); err != nil || !changed {
+		t.Fatal(changed, err)
+	}
+	if !reflect.DeepEqual(d.Hosts(), expected[1:]) {
+		t.Fatalf("expect %v got %v", expected[1:], d.Hosts())
+	}
+
+	writeFile("c.json", `not json`)
+	if _, err := d.Reload(); err == nil {
+		t.Fatal("expect error")
+	}
+	if !reflect.DeepEqual(d.Hosts(), expected[1:]) {
+		t.Fatalf("expect previous hosts %v got %v", expected[1:], d.Hosts())
+	}
+}
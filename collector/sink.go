@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"h12.io/stats"
+	"h12.io/stats/db/influx"
+)
+
+// Sink is a destination that collected stats are exported to
+type Sink interface {
+	SaveStats(s *stats.S, from time.Time, du time.Duration, tags map[string]string) error
+	Close() error
+}
+
+var (
+	sinks = map[string]func(dsn string) (Sink, error){
+		"http": func(dsn string) (Sink, error) { return influx.Open(dsn) },
+	}
+	sinksMu sync.RWMutex
+)
+
+// RegisterSink makes a sink available to OpenSink by the scheme of its DSN
+func RegisterSink(scheme string, open func(dsn string) (Sink, error)) {
+	sinksMu.Lock()
+	sinks[scheme] = open
+	sinksMu.Unlock()
+}
+
+// OpenSink opens a sink registered for the scheme of dsn, "http" opens an
+// influxdb sink
+func OpenSink(dsn string) (Sink, error) {
+	uri, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	sinksMu.RLock()
+	open, ok := sinks[uri.Scheme]
+	sinksMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported sink %s", dsn)
+	}
+	return open(dsn)
+}
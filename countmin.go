@@ -0,0 +1,190 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/dgryski/go-farm"
+	"h12.io/stats/binary"
+)
+
+// CountMin is a Count-Min sketch with conservative update and 32-bit
+// saturating counters. With width ceil(e/epsilon) and depth
+// ceil(ln(1/delta)), a count is never underestimated and is overestimated by
+// at most epsilon*Total() with probability at least 1-delta.
+type CountMin struct {
+	w     int32
+	d     int32
+	total uint64
+	store []uint32
+}
+
+// NewCountMin returns a Count-Min sketch with error epsilon and failure
+// probability delta, both within (0, 1)
+func NewCountMin(epsilon, delta float64) *CountMin {
+	if !(epsilon > 0 && epsilon < 1) || !(delta > 0 && delta < 1) {
+		panic("epsilon and delta should be within (0, 1)")
+	}
+	return NewCountMinWithSize(int32(math.Ceil(math.E/epsilon)), int32(math.Ceil(math.Log(1/delta))))
+}
+
+func NewCountMinWithSize(width, depth int32) *CountMin {
+	if width < 1 || depth < 1 {
+		panic("width and depth should be at least 1")
+	}
+	return &CountMin{
+		w:     width,
+		d:     depth,
+		store: make([]uint32, int(width)*int(depth)),
+	}
+}
+
+// NewCMRingSketcher creates a ring of Count-Min sketches, see NewCountMin
+func NewCMRingSketcher(ringSize int, epsilon, delta float64, startOffset int64) *RingSketcher {
+	a := make([]Sketcher, ringSize)
+	for i := range a {
+		a[i] = NewCountMin(epsilon, delta)
+	}
+	return NewRingSketcher(startOffset, a, func() Sketcher { return &CountMin{} })
+}
+
+// Epsilon returns the relative error of the counts to Total()
+func (s *CountMin) Epsilon() float64 {
+	return math.E / float64(s.w)
+}
+
+// Delta returns the probability that a count exceeds its error bound
+func (s *CountMin) Delta() float64 {
+	return math.Exp(-float64(s.d))
+}
+
+// Total returns the sum of all updates
+func (s *CountMin) Total() uint64 {
+	return s.total
+}
+
+// ErrorBound returns the maximum overestimate of a count with probability
+// 1-Delta()
+func (s *CountMin) ErrorBound() float64 {
+	return s.Epsilon() * float64(s.total)
+}
+
+func (s *CountMin) Diagnostics() Diagnostics {
+	used := 0
+	for _, c := range s.store {
+		if c != 0 {
+			used++
+		}
+	}
+	return Diagnostics{
+		FillRatio:   float64(used) / float64(len(s.store)),
+		Total:       float64(s.total),
+		ErrorBound:  s.ErrorBound(),
+		MemoryBytes: int64(4 * len(s.store)),
+	}
+}
+
+func (s *CountMin) min(h1, h2 uint32) uint32 {
+	w := uint32(s.w)
+	c := uint32(math.MaxUint32)
+	for i := 0; i < int(s.d); i++ {
+		if v := s.store[i*int(w)+int((h1+uint32(i)*h2)%w)]; v < c {
+			c = v
+		}
+	}
+	return c
+}
+
+func (s *CountMin) Get(key []byte) float64 {
+	h1, h2 := cmHash(key)
+	return float64(s.min(h1, h2))
+}
+
+func (s *CountMin) Inc(key []byte) {
+	s.Add(key, 1)
+}
+
+func (s *CountMin) Add(key []byte, n uint64) {
+	if n == 0 {
+		return
+	}
+	s.total += n
+	h1, h2 := cmHash(key)
+	next := uint64(s.min(h1, h2)) + n
+	if next > math.MaxUint32 {
+		next = math.MaxUint32
+	}
+	// conservative update: only raise the counters below the new estimate
+	w := uint32(s.w)
+	for i := 0; i < int(s.d); i++ {
+		if k := &s.store[i*int(w)+int((h1+uint32(i)*h2)%w)]; *k < uint32(next) {
+			*k = uint32(next)
+		}
+	}
+}
+
+func cmHash(key []byte) (h1, h2 uint32) {
+	hsum := farm.Hash64(key)
+	return uint32(hsum), uint32(hsum >> 32)
+}
+
+func (s *CountMin) Reset() {
+	for i := range s.store {
+		s.store[i] = 0
+	}
+	s.total = 0
+}
+
+func (s *CountMin) checkMerge(o Sketcher) error {
+	other, ok := o.(*CountMin)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into CountMin", o)
+	}
+	if s.w != other.w || s.d != other.d {
+		return errors.New("cannot merge CountMins of different dimensions")
+	}
+	return nil
+}
+
+// Merge adds the counters of o, the merged counts are still never
+// underestimated
+func (s *CountMin) Merge(o Sketcher) error {
+	if err := s.checkMerge(o); err != nil {
+		return err
+	}
+	other := o.(*CountMin)
+	for i, c := range other.store {
+		if sum := uint64(s.store[i]) + uint64(c); sum < math.MaxUint32 {
+			s.store[i] = uint32(sum)
+		} else {
+			s.store[i] = math.MaxUint32
+		}
+	}
+	s.total += other.total
+	return nil
+}
+
+func (s *CountMin) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt32(s.w)
+	enc.WriteInt32(s.d)
+	enc.WriteUint64(s.total)
+	enc.WriteUint32Slice(s.store)
+	return enc.Flush()
+}
+
+func (s *CountMin) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	s.w = dec.ReadInt32()
+	s.d = dec.ReadInt32()
+	s.total = dec.ReadUint64()
+	if dec.Err() == nil && (s.w < 1 || s.d < 1 || int64(s.w)*int64(s.d) > binary.MaxSliceLen) {
+		dec.Fail(fmt.Errorf("%w: invalid CountMin dimensions %dx%d", binary.ErrCorrupt, s.w, s.d))
+	}
+	if dec.Err() == nil {
+		s.store = dec.ReadUint32SliceLen(int(s.w) * int(s.d))
+	}
+	return dec.Result()
+}
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestCountMinErrorBound(t *testing.T) {
+	const epsilon, delta = 0.001, 0.01
+	s := NewCountMin(epsilon, delta)
+	if s.Epsilon() > epsilon || s.Delta() > delta {
+		t.Fatalf("expect epsilon %v delta %v within %v %v", s.Epsilon(), s.Delta(), epsilon, delta)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rnd, 1.1, 1, 100000)
+	counts := map[uint64]uint64{}
+	for i := 0; i < 500000; i++ {
+		k := zipf.Uint64()
+		n := uint64(rnd.Intn(3) + 1)
+		counts[k] += n
+		s.Add([]byte(strconv.FormatUint(k, 10)), n)
+	}
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	if s.Total() != total {
+		t.Fatalf("expect total %d got %d", total, s.Total())
+	}
+	exceeded := 0
+	for k, n := range counts {
+		got := s.Get([]byte(strconv.FormatUint(k, 10)))
+		if got < float64(n) {
+			t.Fatalf("%d: count %d underestimated as %v", k, n, got)
+		}
+		if got-float64(n) > s.ErrorBound() {
+			exceeded++
+		}
+	}
+	if rate := float64(exceeded) / float64(len(counts)); rate > delta {
+		t.Fatalf("%v of the counts exceed the error bound %v", rate, s.ErrorBound())
+	}
+}
+
+func TestCountMinSaturate(t *testing.T) {
+	s := NewCountMinWithSize(8, 2)
+	s.Add([]byte("a"), math.MaxUint32-1)
+	s.Add([]byte("a"), 10)
+	if got := s.Get([]byte("a")); got != math.MaxUint32 {
+		t.Fatalf("expect %d got %v", uint32(math.MaxUint32), got)
+	}
+}
+
+func TestCountMinMerge(t *testing.T) {
+	s, o := NewCountMin(0.01, 0.01), NewCountMin(0.01, 0.01)
+	s.Add([]byte("a"), 3)
+	o.Add([]byte("a"), 4)
+	o.Inc([]byte("b"))
+	if err := s.Merge(o); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := s.Get([]byte("a")), s.Get([]byte("b")); a != 7 || b != 1 {
+		t.Fatal(a, b)
+	}
+	if err := s.Merge(NewCountMin(0.1, 0.01)); err == nil {
+		t.Fatal("expect error merging different dimensions")
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d := &CountMin{}
+	if _, err := d.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if d.Get([]byte("a")) != 7 || d.Total() != 8 {
+		t.Fatal(d.Get([]byte("a")), d.Total())
+	}
+}
+
+func TestCMRingSketcher(t *testing.T) {
+	testSketch(t, NewCMRingSketcher(4, 0.01, 0.01, 0))
+}
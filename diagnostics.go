@@ -0,0 +1,81 @@
+package stats
+
+// DefaultFillWarning is the fill ratio above which a sketcher is considered
+// overloaded
+const DefaultFillWarning = 0.5
+
+// The sizes used by MemoryBytes on 64-bit platforms. mapEntryBytes is the
+// share of a map entry besides the key bytes: the 16 byte string header, an
+// 8 byte value or pointer and the tophash and bucket overhead at the average
+// load of a Go map. mapEntrySize and keyCountSize are unsafe.Sizeof of
+// mapEntry and KeyCount.
+const (
+	mapEntryBytes = 48
+	mapEntrySize  = 40
+	keyCountSize  = 32
+)
+
+type (
+	// Diagnostics describes the load and accuracy of a sketcher
+	Diagnostics struct {
+		// FillRatio is the ratio of the used registers or keys to the
+		// capacity
+		FillRatio float64
+		// Total is the estimated sum of all updates
+		Total float64
+		// ErrorBound is the estimated maximum absolute error of a count at
+		// the current load
+		ErrorBound float64
+		// RelativeError is the standard error relative to a count on top of
+		// ErrorBound
+		RelativeError float64
+		// MemoryBytes is the approximate memory footprint
+		MemoryBytes int64
+	}
+	// Diagnoser is implemented by the Sketchers that report Diagnostics
+	Diagnoser interface {
+		Diagnostics() Diagnostics
+	}
+	// SlotDiagnostics are the Diagnostics of the sketcher at Offset
+	SlotDiagnostics struct {
+		Offset int64
+		Diagnostics
+	}
+	// RingDiagnostics summarizes the Diagnostics of every slot of a ring
+	RingDiagnostics struct {
+		Slots        []SlotDiagnostics
+		MaxFillRatio float64
+		MemoryBytes  int64
+		// Overloaded is true when MaxFillRatio exceeds the warning threshold
+		Overloaded bool
+	}
+)
+
+// Diagnostics returns the Diagnostics of the slots whose sketchers implement
+// Diagnoser, the ring is overloaded when a slot fills above fillWarning
+func (m *RingSketcher) Diagnostics(fillWarning float64) RingDiagnostics {
+	return m.diagnostics(fillWarning, func(_ int, sd Diagnoser) Diagnostics {
+		return sd.Diagnostics()
+	})
+}
+
+// diagnostics calls diagnose with the position of every slot that implements
+// Diagnoser
+func (m *RingSketcher) diagnostics(fillWarning float64, diagnose func(int, Diagnoser) Diagnostics) RingDiagnostics {
+	var d RingDiagnostics
+	for offset := m.offset; offset < m.offset+int64(len(m.a)); offset++ {
+		pos := m.pos(offset)
+		sd, ok := m.a[pos].(Diagnoser)
+		if !ok {
+			continue
+		}
+		slot := SlotDiagnostics{Offset: offset, Diagnostics: diagnose(pos, sd)}
+		d.Slots = append(d.Slots, slot)
+		d.MemoryBytes += slot.MemoryBytes
+		if slot.FillRatio > d.MaxFillRatio {
+			d.MaxFillRatio = slot.FillRatio
+		}
+	}
+	d.Overloaded = d.MaxFillRatio > fillWarning
+	return d
+}
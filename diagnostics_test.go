@@ -0,0 +1,76 @@
+package stats
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"h12.io/stats/internal/cml"
+)
+
+func TestDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		s    Sketcher
+	}{
+		{"cml", CMLSketcher{newTestCML(t)}},
+		{"countmin", NewCountMin(0.001, 0.01)},
+		{"map", NewMapSketcher(MapOptions{Capacity: 2000})},
+		{"uint8map", NewUint8MapSketcher(2000)},
+		{"spacesaving", NewSpaceSaving(2000)},
+	} {
+		empty := tc.s.(Diagnoser).Diagnostics()
+		if empty.FillRatio != 0 || empty.Total != 0 {
+			t.Fatalf("%s: expect empty, got %+v", tc.name, empty)
+		}
+		for i := 0; i < 1000; i++ {
+			tc.s.Add([]byte(strconv.Itoa(i)), 10)
+		}
+		d := tc.s.(Diagnoser).Diagnostics()
+		if d.FillRatio <= 0 || d.FillRatio > 1 {
+			t.Fatalf("%s: fill ratio %v", tc.name, d.FillRatio)
+		}
+		if math.Abs(d.Total-10000) > 500 {
+			t.Fatalf("%s: expect total about 10000, got %v", tc.name, d.Total)
+		}
+		if d.MemoryBytes <= 0 || d.ErrorBound < 0 {
+			t.Fatalf("%s: %+v", tc.name, d)
+		}
+	}
+}
+
+func newTestCML(t *testing.T) *cml.Sketch {
+	s, err := cml.NewWithOptions(CMLOptions{Width: 1 << 12, Depth: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMapSketcherDiagnostics(t *testing.T) {
+	s := NewMapSketcher(MapOptions{Capacity: 2})
+	s.Add([]byte("a"), 3)
+	s.Add([]byte("b"), 3)
+	s.Add([]byte("c"), 4)
+	d := s.Diagnostics()
+	if d.FillRatio != 1 || d.Total != 6 || d.ErrorBound != 4 {
+		t.Fatalf("%+v", d)
+	}
+}
+
+func TestRingDiagnostics(t *testing.T) {
+	s := NewMapRingSketcherWithOptions(4, MapOptions{Capacity: 4}, 0)
+	for i := 0; i < 3; i++ {
+		s.Inc(1, []byte(strconv.Itoa(i)))
+	}
+	d := s.Diagnostics(0.5)
+	if len(d.Slots) != 4 || d.Slots[1].Offset != 1 || d.Slots[1].FillRatio != 0.75 {
+		t.Fatalf("%+v", d)
+	}
+	if d.MaxFillRatio != 0.75 || !d.Overloaded {
+		t.Fatalf("%+v", d)
+	}
+	if d := s.Diagnostics(0.8); d.Overloaded {
+		t.Fatalf("%+v", d)
+	}
+}
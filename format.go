@@ -0,0 +1,329 @@
+package stats
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"sync"
+
+	"h12.io/stats/binary"
+	"h12.io/stats/internal/cml"
+)
+
+/*
+A RingSketcher is written as a frame:
+
+	magic    "SKRG"
+	version  uint8
+	flags    uint8, FrameFlags, only since version 2
+	type     string, the name the sketcher is registered with
+	ring     start, offset, size and the sketchers, encoded as the flags select
+	checksum uint32, CRC32 (IEEE) of the bytes from version to ring as written
+
+A frame without flags is written as version 1, so that it is still read by
+the readers before version 2. Rings written before the frame was introduced
+start directly with the ring and are still read with the sketcher
+constructor of the RingSketcher.
+*/
+const (
+	frameMagic   = "SKRG"
+	frameVersion = 2
+)
+
+// FrameFlags select the optional encodings of the ring in a frame
+type FrameFlags uint8
+
+const (
+	// FrameVarint writes the counter slices of the sketchers in the varint
+	// encoding of the binary package, which only stores the nonzero counters
+	FrameVarint FrameFlags = 1 << iota
+	// FrameFlate compresses the ring with DEFLATE
+	FrameFlate
+
+	frameFlagsMask = FrameVarint | FrameFlate
+)
+
+var (
+	ErrChecksum           = errors.New("frame checksum mismatch")
+	ErrUnsupportedVersion = errors.New("unsupported frame format version")
+	ErrUnknownSketcher    = errors.New("unknown sketcher type")
+	ErrEmptyRing          = errors.New("ring has no slots")
+)
+
+var sketcherRegistry = struct {
+	sync.RWMutex
+	constructors map[string]func() Sketcher
+	names        map[reflect.Type]string
+}{
+	constructors: make(map[string]func() Sketcher),
+	names:        make(map[reflect.Type]string),
+}
+
+// RegisterSketcher registers the constructor of an empty Sketcher under
+// name, so that ReadFrom of a RingSketcher picks it for the rings written
+// with sketchers of the same type
+func RegisterSketcher(name string, newSketcher func() Sketcher) {
+	r := &sketcherRegistry
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.constructors[name]; ok {
+		panic("sketcher " + name + " registered twice")
+	}
+	r.constructors[name] = newSketcher
+	r.names[reflect.TypeOf(newSketcher())] = name
+}
+
+func init() {
+	RegisterSketcher("cml", func() Sketcher { return CMLSketcher{&cml.Sketch{}} })
+	RegisterSketcher("uint8map", func() Sketcher { return &Uint8MapSketcher{} })
+	RegisterSketcher("map", func() Sketcher { return &MapSketcher{} })
+	RegisterSketcher("countmin", func() Sketcher { return &CountMin{} })
+	RegisterSketcher("spacesaving", func() Sketcher { return &SpaceSaving{} })
+}
+
+func sketcherName(s Sketcher) (string, bool) {
+	r := &sketcherRegistry
+	r.RLock()
+	defer r.RUnlock()
+	name, ok := r.names[reflect.TypeOf(s)]
+	return name, ok
+}
+
+func sketcherConstructor(name string) (func() Sketcher, bool) {
+	r := &sketcherRegistry
+	r.RLock()
+	defer r.RUnlock()
+	newSketcher, ok := r.constructors[name]
+	return newSketcher, ok
+}
+
+// writeFrame writes the ring within a frame if its sketchers are registered.
+// A ring of unregistered sketchers is written unframed as before the frame
+// was introduced, which has no room for flags.
+func (s *RingSketcher) writeFrame(w io.Writer, flags FrameFlags) (int64, error) {
+	if len(s.a) == 0 {
+		// e.g. a ring from Empty that was never read into
+		return 0, ErrEmptyRing
+	}
+	name, ok := sketcherName(s.a[0])
+	if !ok {
+		if flags != 0 {
+			return 0, fmt.Errorf("%w: %T cannot be written with flags", ErrUnknownSketcher, s.a[0])
+		}
+		return s.writeRing(w)
+	}
+	if flags&^frameFlagsMask != 0 {
+		return 0, fmt.Errorf("unknown frame flags %#x", uint8(flags))
+	}
+	enc := binary.NewEncoder(w)
+	enc.Write([]byte(frameMagic))
+	crc := crc32.NewIEEE()
+	body := binary.NewEncoder(io.MultiWriter(enc, crc))
+	if flags == 0 {
+		body.WriteUint8(1)
+	} else {
+		body.WriteUint8(frameVersion)
+		body.WriteUint8(uint8(flags))
+	}
+	body.WriteString(name)
+	writeEncoded(body, flags, encoderFunc(s.writeRing))
+	if _, err := body.Flush(); err != nil {
+		enc.Fail(err)
+		return enc.Flush()
+	}
+	enc.WriteUint32(crc.Sum32())
+	return enc.Flush()
+}
+
+// readFrame reads a framed ring or an unframed one written before the frame
+// was introduced
+func (s *RingSketcher) readFrame(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	var magic [len(frameMagic)]byte
+	if _, err := io.ReadFull(dec, magic[:]); err != nil {
+		dec.Fail(err)
+		return dec.Result()
+	}
+	if string(magic[:]) != frameMagic {
+		// an unframed ring starts with its start index, which is never
+		// the magic
+		if s.newSketcher == nil {
+			dec.Fail(ErrUnknownSketcher)
+			return dec.Result()
+		}
+		_, err := s.readRing(io.MultiReader(bytes.NewReader(magic[:]), dec), s.newSketcher)
+		dec.Fail(err)
+		return dec.Result()
+	}
+	crc := crc32.NewIEEE()
+	body := binary.NewDecoder(io.TeeReader(dec, crc))
+	var flags FrameFlags
+	switch version := body.ReadUint8(); {
+	case body.Err() != nil, version == 1:
+	case version == frameVersion:
+		flags = FrameFlags(body.ReadUint8())
+		if body.Err() == nil && flags&^frameFlagsMask != 0 {
+			body.Fail(fmt.Errorf("%w: flags %#x", ErrUnsupportedVersion, uint8(flags)))
+		}
+	default:
+		body.Fail(fmt.Errorf("%w: %d", ErrUnsupportedVersion, version))
+	}
+	name := body.ReadString()
+	var newSketcher func() Sketcher
+	if body.Err() == nil {
+		var ok bool
+		if newSketcher, ok = sketcherConstructor(name); !ok {
+			body.Fail(fmt.Errorf("%w: %s", ErrUnknownSketcher, name))
+		}
+	}
+	// the ring is decoded aside and only replaces s once the checksum
+	// matches
+	ring := &RingSketcher{}
+	if body.Err() == nil {
+		readEncoded(body, flags, decoderFunc(func(r io.Reader) (int64, error) {
+			return ring.readRing(r, newSketcher)
+		}))
+	}
+	if err := body.Err(); err != nil {
+		dec.Fail(err)
+		return dec.Result()
+	}
+	sum := crc.Sum32()
+	if expected := dec.ReadUint32(); dec.Err() == nil && sum != expected {
+		dec.Fail(ErrChecksum)
+	}
+	if dec.Err() == nil {
+		s.ringIndex, s.a, s.newSketcher = ring.ringIndex, ring.a, ring.newSketcher
+	}
+	return dec.Result()
+}
+
+/*
+A snapshot of S written by WriteFrame is a frame:
+
+	magic    "SKST"
+	version  uint8
+	flags    uint8, FrameFlags
+	meters   the output of WriteTo, encoded as the flags select
+	checksum uint32, CRC32 (IEEE) of the bytes from version to meters as written
+
+The output of WriteTo starts with the big endian meter count instead, which
+is never the magic, so ReadFrom reads both.
+*/
+const (
+	snapshotMagic   = "SKST"
+	snapshotVersion = 1
+)
+
+func writeSnapshot(w io.Writer, flags FrameFlags, meters io.WriterTo) (int64, error) {
+	if flags&^frameFlagsMask != 0 {
+		return 0, fmt.Errorf("unknown frame flags %#x", uint8(flags))
+	}
+	enc := binary.NewEncoder(w)
+	enc.Write([]byte(snapshotMagic))
+	crc := crc32.NewIEEE()
+	body := binary.NewEncoder(io.MultiWriter(enc, crc))
+	body.WriteUint8(snapshotVersion)
+	body.WriteUint8(uint8(flags))
+	writeEncoded(body, flags, meters)
+	if _, err := body.Flush(); err != nil {
+		enc.Fail(err)
+		return enc.Flush()
+	}
+	enc.WriteUint32(crc.Sum32())
+	return enc.Flush()
+}
+
+func readSnapshot(r io.Reader, meters io.ReaderFrom) (int64, error) {
+	dec := binary.NewDecoder(r)
+	var magic [len(snapshotMagic)]byte
+	if _, err := io.ReadFull(dec, magic[:]); err != nil {
+		dec.Fail(err)
+		return dec.Result()
+	}
+	if string(magic[:]) != snapshotMagic {
+		_, err := meters.ReadFrom(io.MultiReader(bytes.NewReader(magic[:]), dec))
+		dec.Fail(err)
+		return dec.Result()
+	}
+	crc := crc32.NewIEEE()
+	body := binary.NewDecoder(io.TeeReader(dec, crc))
+	if version := body.ReadUint8(); body.Err() == nil && version != snapshotVersion {
+		body.Fail(fmt.Errorf("%w: %d", ErrUnsupportedVersion, version))
+	}
+	flags := FrameFlags(body.ReadUint8())
+	if body.Err() == nil && flags&^frameFlagsMask != 0 {
+		body.Fail(fmt.Errorf("%w: flags %#x", ErrUnsupportedVersion, uint8(flags)))
+	}
+	if body.Err() == nil {
+		readEncoded(body, flags, meters)
+	}
+	if err := body.Err(); err != nil {
+		dec.Fail(err)
+		return dec.Result()
+	}
+	sum := crc.Sum32()
+	if expected := dec.ReadUint32(); dec.Err() == nil && sum != expected {
+		dec.Fail(ErrChecksum)
+	}
+	return dec.Result()
+}
+
+// writeEncoded writes v to body with the encodings selected by flags
+func writeEncoded(body *binary.Encoder, flags FrameFlags, v io.WriterTo) {
+	if flags&FrameFlate != 0 {
+		fw, _ := flate.NewWriter(body, flate.DefaultCompression)
+		enc := binary.NewEncoder(fw)
+		enc.SetVarint(flags&FrameVarint != 0)
+		enc.Encode(v)
+		if _, err := enc.Flush(); err != nil {
+			body.Fail(err)
+		}
+		body.Fail(fw.Close())
+		return
+	}
+	enc := binary.NewEncoder(body)
+	enc.SetVarint(flags&FrameVarint != 0)
+	enc.Encode(v)
+	body.Fail(enc.Err())
+}
+
+// readEncoded reads v written by writeEncoded with the same flags
+func readEncoded(body *binary.Decoder, flags FrameFlags, v io.ReaderFrom) {
+	if flags&FrameFlate != 0 {
+		// body is an io.ByteReader, so the decompressor does not read past
+		// the end of the compressed value
+		fr := flate.NewReader(body)
+		dec := binary.NewDecoder(fr)
+		dec.SetVarint(flags&FrameVarint != 0)
+		dec.Decode(v)
+		if dec.Err() == nil {
+			// consume the end of the compressed stream
+			if n, err := io.Copy(io.Discard, fr); err != nil {
+				dec.Fail(err)
+			} else if n > 0 {
+				dec.Fail(fmt.Errorf("%w: %d bytes after the compressed value", binary.ErrCorrupt, n))
+			}
+		}
+		body.Fail(dec.Err())
+		return
+	}
+	dec := binary.NewDecoder(body)
+	dec.SetVarint(flags&FrameVarint != 0)
+	dec.Decode(v)
+	body.Fail(dec.Err())
+}
+
+// encoderFunc and decoderFunc adapt codec methods to Encoder.Encode and
+// Decoder.Decode
+type (
+	encoderFunc func(io.Writer) (int64, error)
+	decoderFunc func(io.Reader) (int64, error)
+)
+
+func (f encoderFunc) WriteTo(w io.Writer) (int64, error)  { return f(w) }
+func (f decoderFunc) ReadFrom(r io.Reader) (int64, error) { return f(r) }
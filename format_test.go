@@ -0,0 +1,342 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFrameRegistry(t *testing.T) {
+	for _, s := range []*RingSketcher{
+		NewCMLRingSketcherWithOptions(2, CMLOptions{Width: 64, Depth: 2}, 0),
+		NewMapRingSketcher(2, 10, 0),
+		NewMapRingSketcherWithOptions(2, MapOptions{Capacity: 10}, 0),
+		NewCMRingSketcher(2, 0.1, 0.1, 0),
+		NewSpaceSavingRingSketcher(2, 10, 0),
+	} {
+		s.Add(1, []byte("a"), 3)
+		var buf bytes.Buffer
+		wn, err := s.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a ring without constructor picks the sketcher from the registry
+		d := &RingSketcher{}
+		rn, err := d.ReadFrom(&buf)
+		if err != nil {
+			t.Fatalf("%T: %v", s.a[0], err)
+		}
+		if wn != rn {
+			t.Fatalf("%T: wrote %d bytes, read %d", s.a[0], wn, rn)
+		}
+		if v := d.Get(1, []byte("a")); v < 2.5 || v > 3.5 {
+			t.Fatalf("%T: expect 3 got %v", s.a[0], v)
+		}
+	}
+}
+
+func TestFrameEmpty(t *testing.T) {
+	s := NewMapRingSketcher(2, 10, 0).Empty()
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); !errors.Is(err, ErrEmptyRing) {
+		t.Fatalf("expect ErrEmptyRing got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expect nothing written got %d bytes", buf.Len())
+	}
+}
+
+var frameFlags = []FrameFlags{0, FrameVarint, FrameFlate, FrameVarint | FrameFlate}
+
+func TestFrameFlags(t *testing.T) {
+	for _, s := range []*RingSketcher{
+		NewCMLRingSketcherWithOptions(2, CMLOptions{Width: 64, Depth: 2}, 0),
+		NewMapRingSketcherWithOptions(2, MapOptions{Capacity: 10}, 0),
+		NewCMRingSketcher(2, 0.1, 0.1, 0),
+		NewSpaceSavingRingSketcher(2, 10, 0),
+	} {
+		s.Add(1, []byte("a"), 3)
+		var expected bytes.Buffer
+		if _, err := s.WriteTo(&expected); err != nil {
+			t.Fatal(err)
+		}
+		for _, flags := range frameFlags {
+			var buf bytes.Buffer
+			wn, err := s.WriteFrame(&buf, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the trailing byte is left to the next reader
+			buf.WriteByte(0xff)
+			d := &RingSketcher{}
+			rn, err := d.ReadFrom(&buf)
+			if err != nil {
+				t.Fatalf("%T %d: %v", s.a[0], flags, err)
+			}
+			if wn != rn || buf.Len() != 1 {
+				t.Fatalf("%T %d: wrote %d bytes, read %d", s.a[0], flags, wn, rn)
+			}
+			var got bytes.Buffer
+			if _, err := d.WriteTo(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), expected.Bytes()) {
+				t.Fatalf("%T %d: ring changed after a round trip", s.a[0], flags)
+			}
+		}
+	}
+}
+
+func TestFrameFlagsCorrupt(t *testing.T) {
+	s := NewCMLRingSketcherWithOptions(2, CMLOptions{Width: 64, Depth: 2}, 0)
+	s.Add(1, []byte("a"), 3)
+	if _, err := s.WriteFrame(io.Discard, 0x80); err == nil {
+		t.Fatal("expect error of unknown flags")
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteFrame(&buf, FrameFlate); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+	if frame[len(frameMagic)] != frameVersion {
+		t.Fatalf("expect version %d got %d", frameVersion, frame[len(frameMagic)])
+	}
+
+	flags := append([]byte(nil), frame...)
+	flags[len(frameMagic)+1] = 0x80
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(flags)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expect %v got %v", ErrUnsupportedVersion, err)
+	}
+
+	compressed := append([]byte(nil), frame...)
+	compressed[len(compressed)-8] ^= 0xff
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(compressed)); err == nil {
+		t.Fatal("expect error of corrupt compressed ring")
+	}
+}
+
+func TestFrameUnframed(t *testing.T) {
+	s := NewMapRingSketcher(2, 10, 0)
+	s.Add(1, []byte("a"), 3)
+	var buf bytes.Buffer
+	wn, err := s.writeRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrUnknownSketcher) {
+		t.Fatalf("expect %v got %v", ErrUnknownSketcher, err)
+	}
+	d := s.Empty()
+	rn, err := d.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wn != rn {
+		t.Fatalf("wrote %d bytes, read %d", wn, rn)
+	}
+	if v := d.Get(1, []byte("a")); v != 3 {
+		t.Fatalf("expect 3 got %v", v)
+	}
+}
+
+// unregisteredSketcher is a user Sketcher whose type is not registered
+type unregisteredSketcher struct {
+	*Uint8MapSketcher
+}
+
+func TestFrameUnregistered(t *testing.T) {
+	newSketcher := func() Sketcher { return unregisteredSketcher{NewUint8MapSketcher(10)} }
+	s := NewRingSketcher(0, []Sketcher{newSketcher(), newSketcher()}, newSketcher)
+	s.Add(1, []byte("a"), 3)
+	var buf bytes.Buffer
+	if _, err := s.WriteFrame(&buf, FrameFlate); !errors.Is(err, ErrUnknownSketcher) {
+		t.Fatalf("expect %v got %v", ErrUnknownSketcher, err)
+	}
+	// written unframed as before the frame was introduced
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d := s.Empty()
+	if _, err := d.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v := d.Get(1, []byte("a")); v != 3 {
+		t.Fatalf("expect 3 got %v", v)
+	}
+}
+
+func TestFrameCorrupt(t *testing.T) {
+	s := NewMapRingSketcherWithOptions(2, MapOptions{Capacity: 10}, 0)
+	s.Add(1, []byte("abc"), 3)
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	flipped := append([]byte(nil), frame...)
+	flipped[bytes.Index(flipped, []byte("abc"))] = 'x'
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(flipped)); err != ErrChecksum {
+		t.Fatalf("expect %v got %v", ErrChecksum, err)
+	}
+
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(frame[:len(frame)-2])); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	version := append([]byte(nil), frame...)
+	version[len(frameMagic)] = frameVersion + 1
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(version)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expect %v got %v", ErrUnsupportedVersion, err)
+	}
+
+	typ := append([]byte(nil), frame...)
+	typ[bytes.Index(typ, []byte("map"))] = 'n'
+	if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(typ)); !errors.Is(err, ErrUnknownSketcher) {
+		t.Fatalf("expect %v got %v", ErrUnknownSketcher, err)
+	}
+
+	// a failed read keeps the slots and the sketcher constructor
+	d := NewCMRingSketcher(2, 0.1, 0.1, 0).Empty()
+	if _, err := d.ReadFrom(bytes.NewReader(frame[:len(frame)-2])); err == nil {
+		t.Fatal("expect error")
+	}
+	if d.Len() != 0 {
+		t.Fatalf("expect no slots got %d", d.Len())
+	}
+	if _, ok := d.newSketcher().(*CountMin); !ok {
+		t.Fatalf("expect the CountMin constructor kept, got %T", d.newSketcher())
+	}
+}
+
+// benchmarkRings returns rings filled with a skewed stream of keys
+func benchmarkRings() map[string]*RingSketcher {
+	rings := map[string]*RingSketcher{
+		"cml":      NewCMLRingSketcherWithOptions(4, CMLOptions{Capacity: 100000, CapacityFloor: 100000}, 0),
+		"countmin": NewCMRingSketcher(4, 0.0001, 0.001, 0),
+	}
+	for _, s := range rings {
+		rnd := rand.New(rand.NewSource(1))
+		zipf := rand.NewZipf(rnd, 1.1, 1, 1000000)
+		for offset := int64(0); offset < 4; offset++ {
+			for i := 0; i < 100000; i++ {
+				s.Inc(offset, []byte(fmt.Sprint(zipf.Uint64())))
+			}
+		}
+	}
+	return rings
+}
+
+func BenchmarkFrame(b *testing.B) {
+	for name, s := range benchmarkRings() {
+		for _, flags := range frameFlags {
+			var buf bytes.Buffer
+			if _, err := s.WriteFrame(&buf, flags); err != nil {
+				b.Fatal(err)
+			}
+			frame := buf.Bytes()
+			b.Run(fmt.Sprintf("%s/flags=%d/write", name, flags), func(b *testing.B) {
+				b.ReportMetric(float64(len(frame)), "frame-bytes")
+				for i := 0; i < b.N; i++ {
+					if _, err := s.WriteFrame(io.Discard, flags); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run(fmt.Sprintf("%s/flags=%d/read", name, flags), func(b *testing.B) {
+				b.ReportMetric(float64(len(frame)), "frame-bytes")
+				for i := 0; i < b.N; i++ {
+					if _, err := (&RingSketcher{}).ReadFrom(bytes.NewReader(frame)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func benchmarkStats() *S {
+	s := New()
+	now := time.Now()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		m := s.Meter("requests", Tags{"path": "/" + strconv.Itoa(i)})
+		for sec := 0; sec < DefaultBufferSize; sec++ {
+			if rnd.Intn(4) == 0 {
+				m.Inc(now.Add(time.Duration(sec)*time.Second), rnd.Intn(100))
+			}
+		}
+	}
+	return s
+}
+
+func TestStatsFrame(t *testing.T) {
+	s := benchmarkStats()
+	var plain bytes.Buffer
+	if _, err := s.WriteTo(&plain); err != nil {
+		t.Fatal(err)
+	}
+	for _, flags := range frameFlags {
+		var buf bytes.Buffer
+		n, err := s.WriteFrame(&buf, flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(n) != buf.Len() {
+			t.Fatalf("flags %d: wrote %d bytes, counted %d", flags, buf.Len(), n)
+		}
+		if flags != 0 && buf.Len() >= plain.Len() {
+			t.Fatalf("flags %d: frame of %d bytes not smaller than %d", flags, buf.Len(), plain.Len())
+		}
+		frame := buf.Bytes()
+		d := New()
+		if rn, err := d.ReadFrom(bytes.NewReader(frame)); err != nil || rn != n {
+			t.Fatalf("flags %d: read %d bytes of %d: %v", flags, rn, n, err)
+		}
+		if d.String() != s.String() {
+			t.Fatalf("flags %d: snapshot mismatch", flags)
+		}
+
+		corrupt := append([]byte(nil), frame...)
+		corrupt[len(corrupt)/2] ^= 1
+		d = New()
+		if _, err := d.ReadFrom(bytes.NewReader(corrupt)); err == nil {
+			t.Fatalf("flags %d: corrupt snapshot read without error", flags)
+		}
+		if len(d.Meters) != 0 {
+			t.Fatalf("flags %d: %d meters read from a corrupt snapshot", flags, len(d.Meters))
+		}
+	}
+}
+
+func BenchmarkStatsFrame(b *testing.B) {
+	s := benchmarkStats()
+	for _, flags := range frameFlags {
+		var buf bytes.Buffer
+		if _, err := s.WriteFrame(&buf, flags); err != nil {
+			b.Fatal(err)
+		}
+		frame := buf.Bytes()
+		b.Run(fmt.Sprintf("flags=%d/write", flags), func(b *testing.B) {
+			b.ReportMetric(float64(len(frame)), "frame-bytes")
+			for i := 0; i < b.N; i++ {
+				if _, err := s.WriteFrame(io.Discard, flags); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("flags=%d/read", flags), func(b *testing.B) {
+			b.ReportMetric(float64(len(frame)), "frame-bytes")
+			for i := 0; i < b.N; i++ {
+				if _, err := New().ReadFrom(bytes.NewReader(frame)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package stats
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"h12.io/stats/binary"
+	"h12.io/stats/internal/cml"
+)
+
+type readerFrom interface {
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// fuzzTargets returns a valid value and a constructor of an empty one for
+// every type with ReadFrom
+func fuzzTargets() []struct {
+	v     readerFrom
+	empty func() readerFrom
+} {
+	key := []byte("a")
+	cmlSketch, _ := cml.NewWithOptions(CMLOptions{Width: 16, Depth: 2})
+	cmlSketch.Add(key, 3)
+	mapSketch := NewMapSketcher(MapOptions{Capacity: 4, Evict: EvictLRU})
+	mapSketch.Add(key, 3)
+	uint8Map := NewUint8MapSketcher(4)
+	uint8Map.Inc(key)
+	countMin := NewCountMinWithSize(16, 2)
+	countMin.Inc(key)
+	spaceSaving := NewSpaceSaving(4)
+	spaceSaving.Inc(key)
+	ring := NewMapRingSketcherWithOptions(2, MapOptions{Capacity: 4}, 0)
+	ring.Inc(1, key)
+	hll := NewHLL(4)
+	hll.Add(key)
+	ringHLL := NewRingHLL(2, 4, 0)
+	ringHLL.Add(1, key)
+	tdigest := NewTDigest(10)
+	tdigest.Add(1)
+	ringTDigest := NewRingTDigest(2, 10, 0)
+	ringTDigest.Add(1, 1)
+	meter := NewMeter(time.Unix(100, 0), 4)
+	meter.Inc(time.Unix(101, 0), 1)
+	s := New()
+	s.Meter("a", Tags{"b": "c"}).Inc(time.Now(), 1)
+
+	return []struct {
+		v     readerFrom
+		empty func() readerFrom
+	}{
+		{CMLSketcher{cmlSketch}, func() readerFrom { return CMLSketcher{&cml.Sketch{}} }},
+		{mapSketch, func() readerFrom { return &MapSketcher{} }},
+		{uint8Map, func() readerFrom { return &Uint8MapSketcher{} }},
+		{countMin, func() readerFrom { return &CountMin{} }},
+		{spaceSaving, func() readerFrom { return &SpaceSaving{} }},
+		{ring, func() readerFrom { return &RingSketcher{} }},
+		{hll, func() readerFrom { return &HLL{} }},
+		{ringHLL, func() readerFrom { return &RingHLL{} }},
+		{tdigest, func() readerFrom { return &TDigest{} }},
+		{ringTDigest, func() readerFrom { return &RingTDigest{} }},
+		{meter, func() readerFrom { return &Meter{} }},
+		{s, func() readerFrom { return New() }},
+	}
+}
+
+func FuzzReadFrom(f *testing.F) {
+	targets := fuzzTargets()
+	for i, target := range targets {
+		var buf bytes.Buffer
+		if _, err := target.v.WriteTo(&buf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(uint8(i), buf.Bytes())
+		if v, ok := target.v.(interface {
+			WriteFrame(io.Writer, FrameFlags) (int64, error)
+		}); ok {
+			buf.Reset()
+			if _, err := v.WriteFrame(&buf, FrameVarint|FrameFlate); err != nil {
+				f.Fatal(err)
+			}
+			f.Add(uint8(i), buf.Bytes())
+		}
+	}
+	f.Fuzz(func(t *testing.T, i uint8, data []byte) {
+		target := targets[int(i)%len(targets)]
+		v := target.empty()
+		n, err := v.ReadFrom(bytes.NewReader(data))
+		if n < 0 || n > int64(len(data)) {
+			t.Fatalf("%T: read %d bytes of %d", v, n, len(data))
+		}
+		if err != nil {
+			return
+		}
+		// a value read without error must be usable
+		if sk, ok := v.(Sketcher); ok {
+			sk.Get([]byte("a"))
+			sk.Inc([]byte("a"))
+		}
+		if ring, ok := v.(*RingSketcher); ok {
+			ring.Inc(ring.Offset(), []byte("a"))
+		}
+		if _, err := v.WriteTo(io.Discard); err != nil {
+			t.Fatalf("%T: %v", v, err)
+		}
+	})
+}
+
+func TestHugeRingClaims(t *testing.T) {
+	var header bytes.Buffer
+	binary.WriteInt64(&header, 0)
+	binary.WriteInt64(&header, 0)
+	binary.WriteInt64(&header, binary.MaxSliceLen)
+	for _, v := range []io.ReaderFrom{
+		NewCMLRingSketcherWithOptions(1, CMLOptions{Width: 16, Depth: 2}, 0).Empty(),
+		&RingHLL{},
+		&RingTDigest{},
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := v.ReadFrom(bytes.NewReader(header.Bytes()))
+		runtime.ReadMemStats(&after)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("%T: expect %v got %v", v, io.ErrUnexpectedEOF, err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Fatalf("%T: allocated %d bytes", v, n)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/dgryski/go-farm"
+	"h12.io/stats/binary"
+)
+
+// HLL is a HyperLogLog sketch that estimates the number of distinct keys
+// with 2^precision 8-bit registers, the standard error is about
+// 1.04/sqrt(2^precision)
+type HLL struct {
+	p         uint8
+	registers []uint8
+}
+
+func NewHLL(precision uint8) *HLL {
+	if precision < 4 || precision > 18 {
+		panic("precision should be within [4, 18]")
+	}
+	return &HLL{
+		p:         precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+func (h *HLL) Add(key []byte) {
+	x := farm.Hash64(key)
+	i := x >> (64 - h.p)
+	rho := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rho > h.registers[i] {
+		h.registers[i] = rho
+	}
+}
+
+// Count returns the estimated number of distinct keys added
+func (h *HLL) Count() float64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := hllAlpha(len(h.registers)) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// linear counting for small cardinalities
+		return m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+func hllAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// Merge makes h count the union of the keys of h and o
+func (h *HLL) Merge(o *HLL) error {
+	if h.p != o.p {
+		return errors.New("cannot merge HLLs of different precisions")
+	}
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+func (h *HLL) Reset() {
+	for i := range h.registers {
+		h.registers[i] = 0
+	}
+}
+
+func (h *HLL) clone() *HLL {
+	return &HLL{
+		p:         h.p,
+		registers: append([]uint8(nil), h.registers...),
+	}
+}
+
+func (h *HLL) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteUint8(h.p)
+	enc.WriteUint8Slice(h.registers)
+	return enc.Flush()
+}
+
+func (h *HLL) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	h.p = dec.ReadUint8()
+	if dec.Err() == nil && (h.p < 4 || h.p > 18) {
+		dec.Fail(fmt.Errorf("%w: HLL precision %d", binary.ErrCorrupt, h.p))
+	}
+	h.registers = dec.ReadUint8Slice()
+	if dec.Err() == nil && len(h.registers) != 1<<h.p {
+		dec.Fail(fmt.Errorf("%w: HLL register count mismatches precision", binary.ErrCorrupt))
+	}
+	return dec.Result()
+}
+
+// RingHLL is a ring of HLLs parallel to RingSketcher, it counts the distinct
+// keys per offset
+type RingHLL struct {
+	ringIndex
+	a []*HLL
+}
+
+func NewRingHLL(ringSize int, precision uint8, startOffset int64) *RingHLL {
+	if ringSize < 1 {
+		panic("must have at least 1 HLL")
+	}
+	a := make([]*HLL, ringSize)
+	for i := range a {
+		a[i] = NewHLL(precision)
+	}
+	return &RingHLL{
+		ringIndex: ringIndex{offset: startOffset, size: ringSize},
+		a:         a,
+	}
+}
+
+func (m *RingHLL) Offset() int64 {
+	return m.offset
+}
+
+func (m *RingHLL) Add(offset int64, key []byte) {
+	pos := m.rotate(offset, m.reset)
+	if pos < 0 {
+		return
+	}
+	m.a[pos].Add(key)
+}
+
+// Count returns the number of distinct keys at offset
+func (m *RingHLL) Count(offset int64) float64 {
+	pos := m.pos(offset)
+	if pos < 0 {
+		return 0
+	}
+	return m.a[pos].Count()
+}
+
+// CountRange returns the number of distinct keys over the offsets within
+// [from, to], or NaN if the HLLs differ in precision, which NewRingHLL,
+// Merge and ReadFrom do not let happen
+func (m *RingHLL) CountRange(from, to int64) float64 {
+	from, to = m.clip(from, to)
+	var union *HLL
+	for offset := from; offset <= to; offset++ {
+		pos := m.pos(offset)
+		if pos < 0 {
+			continue
+		}
+		if union == nil {
+			union = m.a[pos].clone()
+		} else if err := union.Merge(m.a[pos]); err != nil {
+			return math.NaN()
+		}
+	}
+	if union == nil {
+		return 0
+	}
+	return union.Count()
+}
+
+// Merge makes every offset of m count the union with the same offset of o,
+// m rotates forward if o has newer offsets. m is left unchanged if the HLLs
+// of o differ from the ones of m in precision.
+func (m *RingHLL) Merge(o *RingHLL) error {
+	if len(m.a) > 0 {
+		for _, h := range o.a {
+			if h.p != m.a[0].p {
+				return errors.New("cannot merge HLLs of different precisions")
+			}
+		}
+	}
+	for offset := o.offset; offset < o.offset+int64(o.size); offset++ {
+		pos := m.rotate(offset, m.reset)
+		if pos < 0 {
+			continue
+		}
+		if err := m.a[pos].Merge(o.a[o.pos(offset)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RingHLL) reset(pos int) {
+	m.a[pos].Reset()
+}
+
+func (m *RingHLL) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.Encode(&m.ringIndex)
+	for i := range m.a {
+		enc.Encode(m.a[i])
+	}
+	return enc.Flush()
+}
+
+func (m *RingHLL) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	var index ringIndex
+	dec.Decode(&index)
+	a := make([]*HLL, 0, initialSlots(index.size))
+	for i := 0; i < index.size && dec.Err() == nil; i++ {
+		v := &HLL{}
+		dec.Decode(v)
+		if dec.Err() == nil && i > 0 && v.p != a[0].p {
+			dec.Fail(fmt.Errorf("%w: HLLs of different precisions in a ring", binary.ErrCorrupt))
+		}
+		a = append(a, v)
+	}
+	if dec.Err() == nil {
+		m.ringIndex, m.a = index, a
+	}
+	return dec.Result()
+}
@@ -0,0 +1,88 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHLL(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := NewHLL(14)
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+		if err := math.Abs(h.Count()-float64(n)) / math.Max(float64(n), 1); err > 0.03 {
+			t.Fatalf("count %v of %d distinct keys, error %v", h.Count(), n, err)
+		}
+	}
+}
+
+func TestRingHLL(t *testing.T) {
+	s := NewRingHLL(4, 12, 0)
+	// offset i has keys [i*100, i*100+200)
+	for offset := int64(0); offset < 5; offset++ {
+		for i := offset * 100; i < offset*100+200; i++ {
+			s.Add(offset, []byte(strconv.FormatInt(i, 10)))
+		}
+	}
+	assertApprox := func(actual, expected float64) {
+		t.Helper()
+		if math.Abs(actual-expected)/expected > 0.05 {
+			t.Fatalf("expect %v got %v", expected, actual)
+		}
+	}
+	assertApprox(s.Count(1), 200)
+	assertApprox(s.CountRange(1, 4), 500)
+	assertApprox(s.CountRange(math.MinInt64, math.MaxInt64), 500)
+	if s.Count(0) != 0 {
+		t.Fatalf("offset 0 should have been rotated out")
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var s2 RingHLL
+	if _, err := s2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assertApprox(s2.CountRange(1, 4), 500)
+
+	other := NewRingHLL(4, 12, 1)
+	for i := 1000; i < 1100; i++ {
+		other.Add(4, []byte(strconv.Itoa(i)))
+	}
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	assertApprox(s.Count(4), 300)
+}
+
+func TestRingHLLMergePrecision(t *testing.T) {
+	s := NewRingHLL(2, 12, 0)
+	s.Add(1, []byte("a"))
+	// newer offsets that would rotate s before the precisions are compared
+	if err := s.Merge(NewRingHLL(2, 10, 4)); err == nil {
+		t.Fatal("expect error merging different precisions")
+	}
+	if s.Offset() != 0 || s.Count(1) < 0.5 {
+		t.Fatalf("expect the ring unchanged, offset %d count %v", s.Offset(), s.Count(1))
+	}
+
+	// a ring of different precisions is corrupt
+	mixed := NewRingHLL(2, 12, 0)
+	mixed.a[1] = NewHLL(10)
+	var buf bytes.Buffer
+	if _, err := mixed.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&RingHLL{}).ReadFrom(&buf); err == nil {
+		t.Fatal("expect error reading different precisions")
+	}
+	if v := mixed.CountRange(0, 1); !math.IsNaN(v) {
+		t.Fatalf("expect NaN got %v", v)
+	}
+}
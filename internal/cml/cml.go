@@ -27,9 +27,12 @@ SOFTWARE.
 package cml
 
 import (
+	"container/list"
 	"errors"
+	"fmt"
 	"io"
 	"math"
+	"sync"
 
 	"h12.io/stats/binary"
 
@@ -46,36 +49,180 @@ type Sketch struct {
 	exp float64
 
 	store []uint16
+	rnd   pcgr.Rand
+	t     *tables
 }
 
+/*
+tables holds the values precomputed for every register of a log base
+*/
+type tables struct {
+	// threshold[c] is the probability to increase register c times 2^32
+	threshold [math.MaxUint16 + 1]uint64
+	// value[c] is the count that register c stands for
+	value [math.MaxUint16 + 1]float64
+}
+
+// tableCache shares the tables of the maxCachedTables log bases used most
+// recently, so that sketches read from hostile input cannot grow it without
+// bound nor keep the tables of the legitimate bases out of it
+var tableCache = struct {
+	sync.Mutex
+	m   map[float64]*list.Element // of *cachedTables
+	lru list.List                 // most recently used first
+}{m: make(map[float64]*list.Element)}
+
+type cachedTables struct {
+	exp float64
+	t   *tables
+}
+
+const maxCachedTables = 16
+
+func tablesFor(exp float64) *tables {
+	if t := cachedTablesFor(exp); t != nil {
+		return t
+	}
+	t := &tables{}
+	s := &Sketch{exp: exp}
+	for c := 0; c <= math.MaxUint16; c++ {
+		t.threshold[c] = uint64(math.Ldexp(1/math.Pow(exp, float64(c)), 32))
+		t.value[c] = s.computeValue(uint16(c))
+	}
+	tableCache.Lock()
+	defer tableCache.Unlock()
+	if e, ok := tableCache.m[exp]; ok {
+		tableCache.lru.MoveToFront(e)
+		return e.Value.(*cachedTables).t
+	}
+	tableCache.m[exp] = tableCache.lru.PushFront(&cachedTables{exp: exp, t: t})
+	if tableCache.lru.Len() > maxCachedTables {
+		oldest := tableCache.lru.Back()
+		tableCache.lru.Remove(oldest)
+		delete(tableCache.m, oldest.Value.(*cachedTables).exp)
+	}
+	return t
+}
+
+func cachedTablesFor(exp float64) *tables {
+	tableCache.Lock()
+	defer tableCache.Unlock()
+	e, ok := tableCache.m[exp]
+	if !ok {
+		return nil
+	}
+	tableCache.lru.MoveToFront(e)
+	return e.Value.(*cachedTables).t
+}
+
+/*
+Options configures a Count-Min-Log Sketch, zero fields take the defaults
+*/
+type Options struct {
+	// Capacity is the expected number of distinct keys
+	Capacity int
+	// CapacityFloor is the minimum Capacity, default 1000000
+	CapacityFloor int
+	// ErrorRate is the expected error rate within [0.001, 1), default 0.001
+	ErrorRate float64
+	// Width and Depth override the dimensions computed from Capacity and
+	// ErrorRate, they are set together
+	Width int32
+	Depth int32
+	// LogBase is the base of the log counters, default 1.00026
+	LogBase float64
+	// Seed seeds the random number generator of the sketch, sketches with the
+	// same options and updates have the same counts
+	Seed uint64
+}
+
+const (
+	DefaultCapacityFloor = 1000000
+	DefaultErrorRate     = 0.001
+	DefaultLogBase       = 1.00026
+
+	defaultRandState = 0x0ddc0ffeebadf00d
+	defaultRandInc   = 0xcafebabe
+)
+
 /*
 NewSketch returns a new Count-Min-Log Sketch with 16-bit registers
 */
-func newSketch(w int32, d int32, exp float64) (*Sketch, error) {
-	store := make([]uint16, d*w)
-	return &Sketch{
+func newSketch(w int32, d int32, exp float64, seed uint64) (*Sketch, error) {
+	if w < 1 || d < 1 || int64(w)*int64(d) > binary.MaxSliceLen {
+		return nil, fmt.Errorf("invalid dimensions %dx%d", w, d)
+	}
+	store := make([]uint16, int(d)*int(w))
+	s := &Sketch{
 		w:     w,
 		d:     d,
 		exp:   exp,
 		store: store,
-	}, nil
+		t:     tablesFor(exp),
+	}
+	s.Seed(seed)
+	return s, nil
 }
 
 /*
 New returns a new Count-Min-Log Sketch with 16-bit registers optimized for a given max capacity and expected error rate
 */
 func New(capacity int, e float64) (*Sketch, error) {
+	return NewWithOptions(Options{Capacity: capacity, ErrorRate: e})
+}
+
+/*
+NewWithOptions returns a new Count-Min-Log Sketch with 16-bit registers configured by opt
+*/
+func NewWithOptions(opt Options) (*Sketch, error) {
+	if opt.CapacityFloor == 0 {
+		opt.CapacityFloor = DefaultCapacityFloor
+	}
+	if opt.ErrorRate == 0 {
+		opt.ErrorRate = DefaultErrorRate
+	}
+	if opt.LogBase == 0 {
+		opt.LogBase = DefaultLogBase
+	}
+	if !(opt.LogBase > 1) {
+		return nil, errors.New("log base needs to be > 1")
+	}
+	if opt.Width != 0 || opt.Depth != 0 {
+		if opt.Width <= 0 || opt.Depth <= 0 {
+			return nil, errors.New("width and depth need to be set together and > 0")
+		}
+		return newSketch(opt.Width, opt.Depth, opt.LogBase, opt.Seed)
+	}
+
+	e := opt.ErrorRate
 	if !(e >= 0.001 && e < 1.0) {
 		return nil, errors.New("e needs to be >= 0.001 and < 1.0")
 	}
-	if capacity < 1000000 {
-		capacity = 1000000
+	capacity := opt.Capacity
+	if capacity < opt.CapacityFloor {
+		capacity = opt.CapacityFloor
+	}
+	if capacity < 1 {
+		return nil, errors.New("capacity needs to be >= 1")
 	}
 
 	m := math.Ceil((float64(capacity) * math.Log(e)) / math.Log(1.0/(math.Pow(2.0, math.Log(2.0)))))
 	w := math.Ceil(math.Log(2.0) * m / float64(capacity))
+	if m/w > math.MaxInt32 {
+		return nil, errors.New("capacity is too large")
+	}
 
-	return newSketch(int32(m/w), int32(w), 1.00026)
+	return newSketch(int32(m/w), int32(w), opt.LogBase, opt.Seed)
+}
+
+/*
+Seed resets the random number generator of the sketch
+*/
+func (cml *Sketch) Seed(seed uint64) {
+	cml.rnd = pcgr.Rand{
+		State: defaultRandState + seed,
+		Inc:   defaultRandInc,
+	}
 }
 
 func (s *Sketch) Reset() {
@@ -85,33 +232,74 @@ func (s *Sketch) Reset() {
 }
 
 func (cml *Sketch) increaseDecision(c uint16) bool {
-	return randFloat() < 1/math.Pow(cml.exp, float64(c))
+	return uint64(cml.rnd.Next()) < cml.t.threshold[c]
+}
+
+func hash(e []byte) (h1, h2 uint32) {
+	hsum := farm.Hash64(e)
+	return uint32(hsum & 0xffffffff), uint32((hsum >> 32) & 0xffffffff)
+}
+
+// min returns the minimum of the registers of a key
+func (cml *Sketch) min(h1, h2 uint32) uint16 {
+	w := uint32(cml.w)
+	c := uint16(math.MaxUint16)
+	for i := 0; i < int(cml.d); i++ {
+		if sk := cml.store[i*int(w)+int((h1+uint32(i)*h2)%w)]; sk < c {
+			c = sk
+		}
+	}
+	return c
 }
 
 /*
 Update increases the count of `s` by one, return true if added and the current count of `s`
 */
 func (cml *Sketch) Inc(e []byte) {
-	w := int(cml.w)
-	sk := make([]*uint16, cml.d, cml.d)
-	c := uint16(math.MaxUint16)
+	h1, h2 := hash(e)
+	c := cml.min(h1, h2)
+	if c == math.MaxUint16 || !cml.increaseDecision(c) {
+		return
+	}
+	w := uint32(cml.w)
+	for i := 0; i < int(cml.d); i++ {
+		if k := &cml.store[i*int(w)+int((h1+uint32(i)*h2)%w)]; *k == c {
+			*k = c + 1
+		}
+	}
+}
 
-	hsum := farm.Hash64(e)
-	h1 := uint32(hsum & 0xffffffff)
-	h2 := uint32((hsum >> 32) & 0xffffffff)
+/*
+Add increases the count of `e` by n. The new register value is rounded up or
+down at random so that the expected count increases by exactly n, which takes
+one random number instead of n.
+*/
+func (cml *Sketch) Add(e []byte, n uint64) {
+	switch n {
+	case 0:
+		return
+	case 1:
+		cml.Inc(e)
+		return
+	}
+	h1, h2 := hash(e)
+	c := cml.min(h1, h2)
 
-	for i := range sk {
-		saltedHash := int((h1 + uint32(i)*h2))
-		if sk[i] = &cml.store[i*w+(saltedHash%w)]; *sk[i] < c {
-			c = *sk[i]
+	target := cml.value(c) + float64(n)
+	low := cml.registerFloor(target)
+	next := low
+	if low < math.MaxUint16 {
+		lowValue, highValue := cml.value(low), cml.value(low+1)
+		if cml.randFloat() < (target-lowValue)/(highValue-lowValue) {
+			next = low + 1
 		}
 	}
 
-	if cml.increaseDecision(c) {
-		for _, k := range sk {
-			if *k == c {
-				*k = c + 1
-			}
+	// conservative update: only raise the registers below the new value
+	w := uint32(cml.w)
+	for i := 0; i < int(cml.d); i++ {
+		if k := &cml.store[i*int(w)+int((h1+uint32(i)*h2)%w)]; *k < next {
+			*k = next
 		}
 	}
 }
@@ -124,10 +312,15 @@ func (cml *Sketch) pointValue(c uint16) float64 {
 }
 
 func (cml *Sketch) value(c uint16) float64 {
+	return cml.t.value[c]
+}
+
+func (cml *Sketch) computeValue(c uint16) float64 {
 	if c <= 1 {
 		return cml.pointValue(c)
 	}
-	v := cml.pointValue(c + 1)
+	// pointValue(c + 1) without overflowing the register
+	v := math.Pow(cml.exp, float64(c))
 	return (1 - v) / (1 - cml.exp)
 }
 
@@ -135,82 +328,175 @@ func (cml *Sketch) value(c uint16) float64 {
 Query returns the count of `e`
 */
 func (cml *Sketch) Get(e []byte) float64 {
-	w := int(cml.w)
-	d := int(cml.d)
-	c := uint16(math.MaxUint16)
+	return cml.value(cml.min(hash(e)))
+}
 
-	hsum := farm.Hash64(e)
-	h1 := uint32(hsum & 0xffffffff)
-	h2 := uint32((hsum >> 32) & 0xffffffff)
+/*
+FillRatio returns the ratio of non-zero registers
+*/
+func (cml *Sketch) FillRatio() float64 {
+	if len(cml.store) == 0 {
+		return 0
+	}
+	used := 0
+	for _, c := range cml.store {
+		if c != 0 {
+			used++
+		}
+	}
+	return float64(used) / float64(len(cml.store))
+}
 
-	for i := 0; i < d; i++ {
-		saltedHash := int((h1 + uint32(i)*h2))
-		if sk := cml.store[i*w+(saltedHash%w)]; sk < c {
-			c = sk
+/*
+Total returns the estimated sum of all updates. Keys colliding in a register
+only count once with conservative update, so the sum of each row is scaled by
+the number of keys estimated by linear counting over its used registers.
+*/
+func (cml *Sketch) Total() float64 {
+	w := int(cml.w)
+	total := 0.0
+	for i := 0; i < int(cml.d); i++ {
+		sum, used := 0.0, 0
+		for _, c := range cml.store[i*w : (i+1)*w] {
+			if c != 0 {
+				sum += cml.value(c)
+				used++
+			}
+		}
+		if used > 0 && used < w {
+			keys := -float64(w) * math.Log(1-float64(used)/float64(w))
+			sum *= keys / float64(used)
 		}
+		total += sum
 	}
-	return cml.value(c)
+	return total / float64(cml.d)
 }
 
-var rnd = pcgr.Rand{
-	State: 0x0ddc0ffeebadf00d,
-	Inc:   0xcafebabe,
+/*
+Epsilon returns the error of a count caused by hash collisions relative to
+the total, exceeded with probability Delta
+*/
+func (cml *Sketch) Epsilon() float64 {
+	return math.E / float64(cml.w)
 }
 
-func randFloat() float64 {
-	return float64(rnd.Next()%10e5) / 10e5
+/*
+Delta returns the probability that a count exceeds Epsilon times the total
+*/
+func (cml *Sketch) Delta() float64 {
+	return math.Exp(-float64(cml.d))
 }
 
-func (s *Sketch) WriteTo(w io.Writer) (int64, error) {
-	var err error
-	var nn int
-	n := 0
-	nn, err = binary.WriteInt32(w, s.w)
-	if err != nil {
-		return int64(n), err
+/*
+RelativeError returns the standard error of the log counters relative to a
+count
+*/
+func (cml *Sketch) RelativeError() float64 {
+	return math.Sqrt((cml.exp - 1) / 2)
+}
+
+/*
+MemoryBytes returns the size of the registers, the tables shared by the
+sketches of the same log base are not included
+*/
+func (cml *Sketch) MemoryBytes() int64 {
+	return int64(2 * len(cml.store))
+}
+
+/*
+Merge adds the counts of o register-wise, o must have the same dimensions
+*/
+func (cml *Sketch) Merge(o *Sketch) error {
+	if err := cml.CheckMerge(o); err != nil {
+		return err
+	}
+	for i, c := range o.store {
+		if c != 0 {
+			cml.store[i] = cml.register(cml.value(cml.store[i]) + cml.value(c))
+		}
+	}
+	return nil
+}
+
+// CheckMerge returns the error of Merge for o without merging it
+func (cml *Sketch) CheckMerge(o *Sketch) error {
+	if cml.w != o.w || cml.d != o.d || cml.exp != o.exp {
+		return errors.New("cannot merge sketches of different dimensions")
+	}
+	return nil
+}
+
+// register is the inverse of value, it returns the register whose value is
+// closest to v
+func (cml *Sketch) register(v float64) uint16 {
+	c := cml.inverseValue(v)
+	if c >= math.MaxUint16 {
+		return math.MaxUint16
 	}
-	n += nn
-	nn, err = binary.WriteInt32(w, s.d)
-	if err != nil {
-		return int64(n), err
+	return uint16(c + 0.5)
+}
+
+// registerFloor returns the largest register whose value is not above v
+func (cml *Sketch) registerFloor(v float64) uint16 {
+	c := cml.inverseValue(v)
+	if c >= math.MaxUint16 {
+		return math.MaxUint16
 	}
-	n += nn
-	nn, err = binary.WriteFloat64(w, s.exp)
-	if err != nil {
-		return int64(n), err
+	r := uint16(c)
+	// correct floating point errors around integers
+	if r < math.MaxUint16 && cml.value(r+1) <= v {
+		r++
+	} else if r > 0 && cml.value(r) > v {
+		r--
 	}
-	n += nn
-	nn, err = binary.WriteUint16SliceSparse(w, s.store)
-	if err != nil {
-		return int64(n), err
+	return r
+}
+
+// inverseValue returns the real valued register whose value is v
+func (cml *Sketch) inverseValue(v float64) float64 {
+	if v <= 1 {
+		return v
 	}
-	n += nn
-	return int64(n), nil
+	return math.Log(1+v*(cml.exp-1)) / math.Log(cml.exp)
+}
+
+// randFloat returns a uniform float within [0, 1) with 32 random bits
+func (cml *Sketch) randFloat() float64 {
+	return float64(cml.rnd.Next()) * (1.0 / (1 << 32))
+}
+
+func (s *Sketch) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt32(s.w)
+	enc.WriteInt32(s.d)
+	enc.WriteFloat64(s.exp)
+	enc.WriteUint16SliceSparse(s.store)
+	return enc.Flush()
 }
 
 func (s *Sketch) ReadFrom(r io.Reader) (int64, error) {
-	var err error
-	var nn int
-	n := 0
-	nn, err = binary.ReadInt32(r, &s.w)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.ReadInt32(r, &s.d)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.ReadFloat64(r, &s.exp)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.ReadUint16SliceSparse(r, &s.store)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	return int64(n), nil
+	dec := binary.NewDecoder(r)
+	s.w = dec.ReadInt32()
+	s.d = dec.ReadInt32()
+	s.exp = dec.ReadFloat64()
+	if dec.Err() != nil {
+		return dec.Result()
+	}
+	if !(s.exp > 1) || math.IsInf(s.exp, 1) {
+		dec.Fail(fmt.Errorf("%w: log base needs to be > 1 and finite", binary.ErrCorrupt))
+		return dec.Result()
+	}
+	if s.w < 1 || s.d < 1 || int64(s.w)*int64(s.d) > binary.MaxSliceLen {
+		dec.Fail(fmt.Errorf("%w: invalid dimensions %dx%d", binary.ErrCorrupt, s.w, s.d))
+		return dec.Result()
+	}
+	s.store = dec.ReadUint16SliceSparseLen(int(s.w) * int(s.d))
+	if dec.Err() != nil {
+		return dec.Result()
+	}
+	s.t = tablesFor(s.exp)
+	if s.rnd.Inc == 0 {
+		s.Seed(0)
+	}
+	return dec.Result()
 }
@@ -0,0 +1,178 @@
+package cml
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/dgryski/go-pcgr"
+)
+
+// refInc is the original update with a register slice and math.Pow per call
+func refInc(cml *Sketch, rnd *pcgr.Rand, e []byte) {
+	w := int(cml.w)
+	sk := make([]*uint16, cml.d, cml.d)
+	c := uint16(math.MaxUint16)
+
+	hsum := farm.Hash64(e)
+	h1 := uint32(hsum & 0xffffffff)
+	h2 := uint32((hsum >> 32) & 0xffffffff)
+
+	for i := range sk {
+		saltedHash := int((h1 + uint32(i)*h2))
+		if sk[i] = &cml.store[i*w+(saltedHash%w)]; *sk[i] < c {
+			c = *sk[i]
+		}
+	}
+
+	if float64(rnd.Next()%10e5)/10e5 < 1/math.Pow(cml.exp, float64(c)) {
+		for _, k := range sk {
+			if *k == c {
+				*k = c + 1
+			}
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	s, err := NewWithOptions(Options{Width: 16, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []uint16{0, 1, 2, 100, 30000, math.MaxUint16} {
+		want := 1.0
+		if c > 1 {
+			want = (1 - math.Pow(s.exp, float64(c))) / (1 - s.exp)
+		} else if c == 0 {
+			want = 0
+		}
+		if got := s.value(c); math.Abs(got-want) > want*1e-12 {
+			t.Fatalf("value(%d): expect %v got %v", c, want, got)
+		}
+		p := math.Ldexp(1/math.Pow(s.exp, float64(c)), 32)
+		if got := float64(s.t.threshold[c]); math.Abs(got-p) > 1 {
+			t.Fatalf("threshold(%d): expect %v got %v", c, p, got)
+		}
+	}
+}
+
+func TestTableCache(t *testing.T) {
+	s, err := NewWithOptions(Options{Width: 16, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*maxCachedTables; i++ {
+		tablesFor(1.5 + float64(i)/1000)
+		if tablesFor(s.exp) != s.t {
+			t.Fatalf("tables of %v evicted after %d other bases", s.exp, i+1)
+		}
+	}
+	// a base first seen after the cache is full is still cached
+	if exp := 1.25; tablesFor(exp) != tablesFor(exp) {
+		t.Fatalf("tables of %v not cached", exp)
+	}
+	if n := len(tableCache.m); n > maxCachedTables {
+		t.Fatalf("expect at most %d cached tables got %d", maxCachedTables, n)
+	}
+}
+
+func TestOptionsDimensions(t *testing.T) {
+	for _, opt := range []Options{
+		{Width: 16},
+		{Depth: 2},
+		{Width: -16, Depth: 2},
+		{Width: math.MaxInt32, Depth: math.MaxInt32},
+	} {
+		if _, err := NewWithOptions(opt); err == nil {
+			t.Fatalf("expect error for %dx%d", opt.Width, opt.Depth)
+		}
+	}
+}
+
+func TestIncAccuracy(t *testing.T) {
+	opt := Options{Width: 1 << 14, Depth: 4}
+	s, _ := NewWithOptions(opt)
+	ref, _ := NewWithOptions(opt)
+	rnd := pcgr.Rand{State: 42, Inc: defaultRandInc}
+	counts := map[string]int{}
+	for i := 0; i < 200000; i++ {
+		key := "k" + strconv.Itoa(i%1000)
+		if i%1000 < 10 {
+			key = "hot" + strconv.Itoa(i%10)
+		}
+		counts[key]++
+		s.Inc([]byte(key))
+		refInc(ref, &rnd, []byte(key))
+	}
+	for key, n := range counts {
+		got, want := s.Get([]byte(key)), ref.Get([]byte(key))
+		if math.Abs(got-want) > 0.05*float64(n)+2 {
+			t.Fatalf("%s: count %d, expect %v got %v", key, n, want, got)
+		}
+		if math.Abs(got-float64(n)) > 0.05*float64(n)+2 {
+			t.Fatalf("%s: expect %d got %v", key, n, got)
+		}
+	}
+}
+
+func TestIncSaturate(t *testing.T) {
+	s, _ := NewWithOptions(Options{Width: 4, Depth: 1})
+	for i := range s.store {
+		s.store[i] = math.MaxUint16
+	}
+	s.Inc([]byte("a"))
+	if got := s.Get([]byte("a")); got != s.value(math.MaxUint16) {
+		t.Fatalf("expect saturated count, got %v", got)
+	}
+}
+
+func TestIncAllocs(t *testing.T) {
+	s, _ := NewWithOptions(Options{Width: 1 << 10, Depth: 4})
+	key := []byte("key")
+	if n := testing.AllocsPerRun(100, func() { s.Inc(key) }); n != 0 {
+		t.Fatalf("expect no allocation, got %v", n)
+	}
+}
+
+func BenchmarkInc(b *testing.B) {
+	s, _ := New(0, 0)
+	keys := benchKeys()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Inc(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkIncReference(b *testing.B) {
+	s, _ := New(0, 0)
+	rnd := pcgr.Rand{State: 42, Inc: defaultRandInc}
+	keys := benchKeys()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		refInc(s, &rnd, keys[i%len(keys)])
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	s, _ := New(0, 0)
+	keys := benchKeys()
+	for _, key := range keys {
+		s.Add(key, 1000)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Get(keys[i%len(keys)])
+	}
+}
+
+func benchKeys() [][]byte {
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = []byte("key" + strconv.Itoa(i))
+	}
+	return keys
+}
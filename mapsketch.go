@@ -0,0 +1,321 @@
+package stats
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"h12.io/stats/binary"
+)
+
+// EvictPolicy decides what a MapSketcher does with a new key once full
+type EvictPolicy uint8
+
+const (
+	// EvictNone drops the updates of new keys
+	EvictNone EvictPolicy = iota
+	// EvictSmallest replaces the key with the smallest count
+	EvictSmallest
+	// EvictLRU replaces the least recently updated key
+	EvictLRU
+	// EvictOverflow counts the updates of new keys into a shared bucket
+	EvictOverflow
+)
+
+type (
+	// MapOptions configures a MapSketcher
+	MapOptions struct {
+		// Capacity is the maximum number of keys
+		Capacity int32
+		// Bits is the width of the counters, 16 or 32, default 32
+		Bits int
+		// Evict is the policy for new keys once Capacity is reached
+		Evict EvictPolicy
+	}
+	// MapStats counts the updates a MapSketcher could not record exactly
+	MapStats struct {
+		// Dropped is the sum of updates of new keys dropped when full
+		Dropped uint64
+		// Saturated is the sum of updates lost to counters at their maximum
+		Saturated uint64
+		// Evicted is the number of keys evicted
+		Evicted uint64
+		// Overflow is the sum of updates counted into the overflow bucket
+		Overflow uint64
+	}
+	// MapSketcher is an exact Sketcher for at most Capacity keys with 16 or
+	// 32-bit saturating counters
+	MapSketcher struct {
+		opt   MapOptions
+		max   uint32
+		m     map[string]*mapEntry
+		h     mapHeap
+		tick  uint64
+		stats MapStats
+	}
+	mapEntry struct {
+		key   string
+		count uint32
+		tick  uint64 // last update
+		pos   int    // index within the heap
+	}
+	// mapHeap orders the entries by eviction priority
+	mapHeap struct {
+		a   []*mapEntry
+		lru bool
+	}
+)
+
+func NewMapSketcher(opt MapOptions) *MapSketcher {
+	s := &MapSketcher{opt: opt}
+	if err := s.init(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// NewMapRingSketcherWithOptions creates a ring of MapSketchers configured by
+// opt
+func NewMapRingSketcherWithOptions(ringSize int, opt MapOptions, startOffset int64) *RingSketcher {
+	a := make([]Sketcher, ringSize)
+	for i := range a {
+		a[i] = NewMapSketcher(opt)
+	}
+	return NewRingSketcher(startOffset, a, func() Sketcher { return &MapSketcher{} })
+}
+
+func (s *MapSketcher) init() error {
+	switch s.opt.Bits {
+	case 0, 32:
+		s.opt.Bits = 32
+		s.max = math.MaxUint32
+	case 16:
+		s.max = math.MaxUint16
+	default:
+		return fmt.Errorf("unsupported counter bits %d", s.opt.Bits)
+	}
+	if s.opt.Capacity < 1 {
+		return fmt.Errorf("capacity must be at least 1, got %d", s.opt.Capacity)
+	}
+	if s.opt.Evict > EvictOverflow {
+		return fmt.Errorf("unknown evict policy %d", s.opt.Evict)
+	}
+	s.Reset()
+	return nil
+}
+
+func (s *MapSketcher) Get(key []byte) float64 {
+	if e, ok := s.m[string(key)]; ok {
+		return float64(e.count)
+	}
+	return 0
+}
+
+func (s *MapSketcher) Inc(key []byte) {
+	s.Add(key, 1)
+}
+
+func (s *MapSketcher) Add(key []byte, n uint64) {
+	if n == 0 {
+		return
+	}
+	s.tick++
+	if e, ok := s.m[string(key)]; ok {
+		s.update(e, n)
+		return
+	}
+	if len(s.m) >= int(s.opt.Capacity) {
+		switch s.opt.Evict {
+		case EvictNone:
+			s.stats.Dropped += n
+			return
+		case EvictOverflow:
+			s.stats.Overflow += n
+			return
+		}
+		e := heap.Pop(&s.h).(*mapEntry)
+		delete(s.m, e.key)
+		s.stats.Evicted++
+	}
+	e := &mapEntry{key: string(key)}
+	s.m[e.key] = e
+	if s.heaped() {
+		heap.Push(&s.h, e)
+	}
+	s.update(e, n)
+}
+
+func (s *MapSketcher) update(e *mapEntry, n uint64) {
+	if room := uint64(s.max - e.count); n > room {
+		s.stats.Saturated += n - room
+		n = room
+	}
+	e.count += uint32(n)
+	e.tick = s.tick
+	if s.heaped() {
+		heap.Fix(&s.h, e.pos)
+	}
+}
+
+func (s *MapSketcher) heaped() bool {
+	return s.opt.Evict == EvictSmallest || s.opt.Evict == EvictLRU
+}
+
+// Overflow returns the sum of updates of the keys not tracked with
+// EvictOverflow
+func (s *MapSketcher) Overflow() float64 {
+	return float64(s.stats.Overflow)
+}
+
+// Stats returns the counts of updates not recorded exactly since the last
+// Reset
+func (s *MapSketcher) Stats() MapStats {
+	return s.stats
+}
+
+// Diagnostics bounds the underestimate of a count by the updates not recorded
+func (s *MapSketcher) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		FillRatio:  float64(len(s.m)) / float64(s.opt.Capacity),
+		Total:      float64(s.stats.Overflow),
+		ErrorBound: float64(s.stats.Dropped + s.stats.Saturated + s.stats.Overflow),
+	}
+	for k, e := range s.m {
+		d.Total += float64(e.count)
+		d.MemoryBytes += int64(len(k)) + mapEntryBytes + mapEntrySize
+	}
+	if s.heaped() {
+		d.MemoryBytes += int64(8 * cap(s.h.a))
+	}
+	return d
+}
+
+func (s *MapSketcher) Reset() {
+	s.m = make(map[string]*mapEntry)
+	s.h = mapHeap{lru: s.opt.Evict == EvictLRU}
+	s.tick = 0
+	s.stats = MapStats{}
+}
+
+// Merge adds the counts and stats of o, keys of o are added in descending
+// order of count so the largest ones are kept when s is full
+func (s *MapSketcher) Merge(o Sketcher) error {
+	other, ok := o.(*MapSketcher)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into MapSketcher", o)
+	}
+	entries := make([]*mapEntry, 0, len(other.m))
+	for _, e := range other.m {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+	for _, e := range entries {
+		s.Add([]byte(e.key), uint64(e.count))
+	}
+	s.stats.Dropped += other.stats.Dropped
+	s.stats.Saturated += other.stats.Saturated
+	s.stats.Evicted += other.stats.Evicted
+	s.stats.Overflow += other.stats.Overflow
+	return nil
+}
+
+// entries returns the entries from the least to the most recently updated
+func (s *MapSketcher) entries() []*mapEntry {
+	entries := make([]*mapEntry, 0, len(s.m))
+	for _, e := range s.m {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tick < entries[j].tick })
+	return entries
+}
+
+func (s *MapSketcher) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt32(s.opt.Capacity)
+	enc.WriteUint8(uint8(s.opt.Bits))
+	enc.WriteUint8(uint8(s.opt.Evict))
+	enc.WriteUint64(s.stats.Dropped)
+	enc.WriteUint64(s.stats.Saturated)
+	enc.WriteUint64(s.stats.Evicted)
+	enc.WriteUint64(s.stats.Overflow)
+	enc.WriteInt32(int32(len(s.m)))
+	for _, e := range s.entries() {
+		enc.WriteString(e.key)
+		enc.WriteUint32(e.count)
+	}
+	return enc.Flush()
+}
+
+func (s *MapSketcher) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	s.opt.Capacity = dec.ReadInt32()
+	s.opt.Bits = int(dec.ReadUint8())
+	s.opt.Evict = EvictPolicy(dec.ReadUint8())
+	if dec.Err() != nil {
+		return dec.Result()
+	}
+	if err := s.init(); err != nil {
+		dec.Fail(fmt.Errorf("%w: %v", binary.ErrCorrupt, err))
+		return dec.Result()
+	}
+	s.stats.Dropped = dec.ReadUint64()
+	s.stats.Saturated = dec.ReadUint64()
+	s.stats.Evicted = dec.ReadUint64()
+	s.stats.Overflow = dec.ReadUint64()
+	size := dec.ReadInt32()
+	if dec.Err() == nil && size > s.opt.Capacity {
+		dec.Fail(fmt.Errorf("%w: %d keys exceed capacity %d", binary.ErrCorrupt, size, s.opt.Capacity))
+	}
+	for i := 0; i < int(size) && dec.Err() == nil; i++ {
+		e := &mapEntry{key: dec.ReadString(), count: dec.ReadUint32()}
+		if dec.Err() != nil {
+			break
+		}
+		if e.count > s.max {
+			dec.Fail(fmt.Errorf("%w: count %d exceeds %d-bit counter", binary.ErrCorrupt, e.count, s.opt.Bits))
+			break
+		}
+		if _, ok := s.m[e.key]; ok {
+			dec.Fail(fmt.Errorf("%w: duplicate key %q", binary.ErrCorrupt, e.key))
+			break
+		}
+		s.tick++
+		e.tick = s.tick
+		s.m[e.key] = e
+		if s.heaped() {
+			heap.Push(&s.h, e)
+		}
+	}
+	return dec.Result()
+}
+
+func (h *mapHeap) Len() int { return len(h.a) }
+func (h *mapHeap) Less(i, j int) bool {
+	a, b := h.a[i], h.a[j]
+	if !h.lru && a.count != b.count {
+		return a.count < b.count
+	}
+	return a.tick < b.tick
+}
+func (h *mapHeap) Swap(i, j int) {
+	h.a[i], h.a[j] = h.a[j], h.a[i]
+	h.a[i].pos = i
+	h.a[j].pos = j
+}
+func (h *mapHeap) Push(x interface{}) {
+	e := x.(*mapEntry)
+	e.pos = len(h.a)
+	h.a = append(h.a, e)
+}
+func (h *mapHeap) Pop() interface{} {
+	e := h.a[len(h.a)-1]
+	h.a = h.a[:len(h.a)-1]
+	return e
+}
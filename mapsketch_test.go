@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMapSketcherEvict(t *testing.T) {
+	for _, tc := range []struct {
+		evict EvictPolicy
+		kept  []string
+		gone  string
+		stats MapStats
+	}{
+		{EvictNone, []string{"a", "b"}, "c", MapStats{Dropped: 1}},
+		{EvictSmallest, []string{"a", "c"}, "b", MapStats{Evicted: 1}},
+		{EvictLRU, []string{"b", "c"}, "a", MapStats{Evicted: 1}},
+		{EvictOverflow, []string{"a", "b"}, "c", MapStats{Overflow: 1}},
+	} {
+		s := NewMapSketcher(MapOptions{Capacity: 2, Evict: tc.evict})
+		s.Add([]byte("a"), 5)
+		s.Add([]byte("b"), 2)
+		s.Inc([]byte("b"))
+		s.Inc([]byte("c"))
+		for _, key := range tc.kept {
+			if s.Get([]byte(key)) == 0 {
+				t.Fatalf("policy %d: expect %s kept", tc.evict, key)
+			}
+		}
+		if got := s.Get([]byte(tc.gone)); got != 0 {
+			t.Fatalf("policy %d: expect %s gone, got %v", tc.evict, tc.gone, got)
+		}
+		if s.Stats() != tc.stats {
+			t.Fatalf("policy %d: expect %+v got %+v", tc.evict, tc.stats, s.Stats())
+		}
+	}
+}
+
+func TestMapSketcherSaturate(t *testing.T) {
+	s := NewMapSketcher(MapOptions{Capacity: 10, Bits: 16})
+	s.Add([]byte("a"), 65530)
+	s.Add([]byte("a"), 10)
+	if got := s.Get([]byte("a")); got != 65535 {
+		t.Fatalf("expect 65535 got %v", got)
+	}
+	if s.Stats().Saturated != 5 {
+		t.Fatalf("expect 5 saturated, got %+v", s.Stats())
+	}
+	s = NewMapSketcher(MapOptions{Capacity: 10})
+	s.Add([]byte("a"), 1000000)
+	if got := s.Get([]byte("a")); got != 1000000 {
+		t.Fatalf("expect 1000000 got %v", got)
+	}
+}
+
+func TestMapSketcherMerge(t *testing.T) {
+	s := NewMapSketcher(MapOptions{Capacity: 2, Evict: EvictSmallest})
+	o := NewMapSketcher(MapOptions{Capacity: 3, Evict: EvictSmallest})
+	s.Add([]byte("a"), 3)
+	s.Add([]byte("x"), 1)
+	o.Add([]byte("a"), 4)
+	o.Add([]byte("b"), 10)
+	if err := s.Merge(o); err != nil {
+		t.Fatal(err)
+	}
+	if a, b, x := s.Get([]byte("a")), s.Get([]byte("b")), s.Get([]byte("x")); a != 7 || b != 10 || x != 0 {
+		t.Fatal(a, b, x)
+	}
+	if s.Stats().Evicted != 1 {
+		t.Fatalf("expect 1 evicted, got %+v", s.Stats())
+	}
+	if err := s.Merge(NewUint8MapSketcher(1)); err == nil {
+		t.Fatal("expect error merging different sketchers")
+	}
+}
+
+func TestMapSketcherBinary(t *testing.T) {
+	s := NewMapSketcher(MapOptions{Capacity: 2, Bits: 16, Evict: EvictLRU})
+	s.Add([]byte("a"), 300)
+	s.Inc([]byte("b"))
+	s.Inc([]byte("c"))
+	var buf bytes.Buffer
+	wn, err := s.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &MapSketcher{}
+	rn, err := d.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wn != rn {
+		t.Fatalf("wrote %d bytes, read %d", wn, rn)
+	}
+	if d.opt != s.opt || d.Stats() != s.Stats() {
+		t.Fatalf("expect %+v %+v got %+v %+v", s.opt, s.Stats(), d.opt, d.Stats())
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if d.Get([]byte(key)) != s.Get([]byte(key)) {
+			t.Fatalf("%s: expect %v got %v", key, s.Get([]byte(key)), d.Get([]byte(key)))
+		}
+	}
+	// LRU order survives the round trip
+	d.Inc([]byte("d"))
+	if d.Get([]byte("b")) != 0 || d.Get([]byte("c")) != 1 {
+		t.Fatal("expect b evicted")
+	}
+}
@@ -3,9 +3,12 @@ package stats
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"strconv"
 	"sync"
 	"time"
+
+	"h12.io/stats/binary"
 )
 
 type Meter struct {
@@ -27,6 +30,13 @@ func (m *Meter) StartTime() time.Time {
 	return time.Unix(int64(m.startSec), 0)
 }
 
+// Window returns the range of seconds [start, end) covered by the meter
+func (m *Meter) Window() (start, end int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.startSec, m.startSec + len(m.a)
+}
+
 func (m *Meter) Inc(t time.Time, value int) {
 	m.mu.Lock()
 	m.add(int(t.Unix()), value)
@@ -41,7 +51,8 @@ func (m *Meter) Get(sec int) int {
 }
 
 func (m *Meter) add(sec, value int) {
-	if sec < m.startSec {
+	if sec < m.startSec || len(m.a) == 0 {
+		// an empty meter, e.g. from Range, has no seconds to count in
 		return
 	}
 	// TRUE: sec >= m.startSec
@@ -76,14 +87,42 @@ func (m *Meter) get(sec int) int {
 }
 
 func (m *Meter) Merge(o *Meter) {
+	m.MergeShift(o, 0)
+}
+
+// MergeShift merges o into m with every second of o moved by shift seconds
+func (m *Meter) MergeShift(o *Meter, shift int) {
 	m.mu.Lock()
 	for i := range o.a {
 		sec := o.startSec + i
-		m.add(sec, o.get(sec))
+		m.add(sec+shift, o.get(sec))
 	}
 	m.mu.Unlock()
 }
 
+// Range returns a copy of the meter that only covers seconds within [from, to)
+func (m *Meter) Range(from, to int) *Meter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if from < m.startSec {
+		from = m.startSec
+	}
+	if end := m.startSec + len(m.a); to > end {
+		to = end
+	}
+	if to < from {
+		to = from
+	}
+	r := &Meter{
+		startSec: from,
+		a:        make([]int, to-from),
+	}
+	for i := range r.a {
+		r.a[i] = m.get(from + i)
+	}
+	return r
+}
+
 func (m *Meter) MarshalJSON() ([]byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -123,6 +162,51 @@ func (m *Meter) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+func (m *Meter) WriteTo(w io.Writer) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	enc := binary.NewEncoder(w)
+	enc.WriteInt64(int64(m.startSec))
+	enc.WriteInt64(int64(len(m.a)))
+	for i := range m.a {
+		if enc.Varint() {
+			enc.WriteVarint(int64(m.get(m.startSec + i)))
+		} else {
+			enc.WriteInt64(int64(m.get(m.startSec + i)))
+		}
+	}
+	return enc.Flush()
+}
+
+func (m *Meter) ReadFrom(r io.Reader) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dec := binary.NewDecoder(r)
+	startSec := dec.ReadInt64()
+	size := dec.ReadInt64()
+	if dec.Err() == nil {
+		dec.Fail(binary.CheckLen(size, binary.MaxSliceLen))
+	}
+	var a []int
+	for i := int64(0); i < size && dec.Err() == nil; i++ {
+		if dec.Varint() {
+			a = append(a, int(dec.ReadVarint()))
+		} else {
+			a = append(a, int(dec.ReadInt64()))
+		}
+	}
+	if dec.Err() != nil {
+		return dec.Result()
+	}
+	if len(a) < len(m.a) {
+		a = append(a, make([]int, len(m.a)-len(a))...)
+	}
+	m.startSec = int(startSec)
+	m.start = 0
+	m.a = a
+	return dec.Result()
+}
+
 func (m *Meter) String() string {
 	buf, _ := m.MarshalJSON()
 	return string(buf)
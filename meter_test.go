@@ -135,3 +135,18 @@ func BenchmarkMeter(b *testing.B) {
 func unixStr(t time.Time) string {
 	return strconv.Itoa(int(t.Unix()))
 }
+
+func TestMeterMergeShift(t *testing.T) {
+	now := time.Now()
+
+	m1 := NewMeter(now, 2)
+	m1.Inc(now, 1)
+	m1.Inc(now.Add(time.Second), 2)
+
+	m2 := NewMeter(now, 2)
+	m2.MergeShift(m1, -1)
+	expected := `[` + unixStr(now) + `,2,0]`
+	if expected != m2.String() {
+		t.Fatalf("expect %s but got %s", expected, m2.String())
+	}
+}
@@ -1,22 +1,28 @@
 package stats
 
 import (
+	"fmt"
 	"io"
+	"reflect"
 
 	"h12.io/stats/binary"
 )
 
 type (
 	RingSketcher struct {
-		start       int64
-		offset      int64
+		ringIndex
 		a           []Sketcher
 		newSketcher func() Sketcher
 	}
 	Sketcher interface {
 		Get([]byte) float64
 		Inc([]byte)
+		// Add increases the count of a key by n
+		Add([]byte, uint64)
 		Reset()
+		// Merge adds the counts of another sketcher of the same type and
+		// dimensions
+		Merge(Sketcher) error
 		WriteTo(io.Writer) (int64, error)
 		ReadFrom(io.Reader) (int64, error)
 	}
@@ -27,8 +33,7 @@ func NewRingSketcher(offset int64, a []Sketcher, newSketcher func() Sketcher) *R
 		panic("must have at least 1 sketcher")
 	}
 	return &RingSketcher{
-		start:       0,
-		offset:      offset,
+		ringIndex:   ringIndex{offset: offset, size: len(a)},
 		a:           a,
 		newSketcher: newSketcher,
 	}
@@ -38,100 +43,183 @@ func (m *RingSketcher) Offset() int64 {
 	return m.offset
 }
 
+// Len returns the number of offsets in the ring
+func (m *RingSketcher) Len() int {
+	return len(m.a)
+}
+
 func (m *RingSketcher) Get(offset int64, key []byte) float64 {
-	if offset < m.offset || offset >= m.offset+int64(len(m.a)) {
+	sk := m.Sketcher(offset)
+	if sk == nil {
 		return 0
 	}
-	pos := int(m.start + offset - m.offset)
-	if pos >= len(m.a) {
-		pos -= len(m.a)
+	return sk.Get(key)
+}
+
+// Sketcher returns the sketcher at offset or nil if offset is out of the ring
+func (m *RingSketcher) Sketcher(offset int64) Sketcher {
+	pos := m.pos(offset)
+	if pos < 0 {
+		return nil
 	}
-	return m.a[pos].Get(key)
+	return m.a[pos]
+}
+
+// Sum returns the sum of the counts of key over the offsets within [from, to]
+func (m *RingSketcher) Sum(from, to int64, key []byte) float64 {
+	from, to = m.clip(from, to)
+	sum := 0.0
+	for offset := from; offset <= to; offset++ {
+		sum += m.Get(offset, key)
+	}
+	return sum
+}
+
+// Max returns the maximum count of key over the offsets within [from, to]
+func (m *RingSketcher) Max(from, to int64, key []byte) float64 {
+	from, to = m.clip(from, to)
+	max := 0.0
+	for offset := from; offset <= to; offset++ {
+		if v := m.Get(offset, key); v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Last returns the sum of the counts of key over the last n offsets of the
+// ring
+func (m *RingSketcher) Last(n int, key []byte) float64 {
+	end := m.offset + int64(len(m.a)) - 1
+	return m.Sum(end-int64(n)+1, end, key)
 }
 
 func (m *RingSketcher) Inc(offset int64, key []byte) {
-	if offset < m.offset {
+	pos := m.rotate(offset, m.reset)
+	if pos < 0 {
 		return
 	}
-	// TRUE: offset >= m.offset
+	m.a[pos].Inc(key)
+}
 
-	for offset >= m.offset+int64(len(m.a)) {
-		m.a[m.start].Reset()
-		m.start++
-		m.offset++
-		if int(m.start) == len(m.a) {
-			m.start = 0
-		}
+func (m *RingSketcher) Add(offset int64, key []byte, n uint64) {
+	pos := m.rotate(offset, m.reset)
+	if pos < 0 {
+		return
 	}
-	// TRUE: m.offset <= offset && offset < m.offset+len(m.a)
+	m.a[pos].Add(key, n)
+}
 
-	delta := offset - m.offset
-	// TRUE: 0 <= delta && delta < len(m.a)
+// Advance moves the ring forward until it covers offset, the slots that
+// fall out of the ring are reset
+func (m *RingSketcher) Advance(offset int64) {
+	m.rotate(offset, m.reset)
+}
+
+func (m *RingSketcher) reset(pos int) {
+	m.a[pos].Reset()
+}
 
-	pos := int(m.start + delta)
-	if pos >= len(m.a) {
-		pos -= len(m.a)
+// Merge adds the sketchers of o into the sketchers of m at the same offsets,
+// m rotates forward if o has newer offsets. m is left unchanged if CheckMerge
+// fails.
+func (m *RingSketcher) Merge(o *RingSketcher) error {
+	if err := m.CheckMerge(o); err != nil {
+		return err
+	}
+	for offset := o.offset; offset < o.offset+int64(o.size); offset++ {
+		pos := m.rotate(offset, m.reset)
+		if pos < 0 {
+			continue
+		}
+		if err := m.a[pos].Merge(o.Sketcher(offset)); err != nil {
+			return err
+		}
 	}
-	m.a[pos].Inc(key)
+	return nil
 }
 
-func (s *RingSketcher) WriteTo(w io.Writer) (int64, error) {
-	var err error
-	var nn int
-	n := 0
-	nn, err = binary.WriteInt64(w, s.start)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.WriteInt64(w, s.offset)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.WriteInt64(w, int64(len(s.a)))
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	for i := range s.a {
-		nn, err := s.a[i].WriteTo(w)
-		if err != nil {
-			return int64(n), err
+// CheckMerge returns an error if the sketchers of o differ from the ones of m
+// in type or dimensions, so that they cannot be merged
+func (m *RingSketcher) CheckMerge(o *RingSketcher) error {
+	if len(m.a) == 0 {
+		return nil
+	}
+	// the sketchers of a ring are created alike
+	for _, sk := range o.a {
+		if err := checkMerge(m.a[0], sk); err != nil {
+			return err
 		}
-		n += int(nn)
 	}
-	return int64(n), nil
+	return nil
+}
+
+// mergeChecker is implemented by the Sketchers whose Merge fails for other
+// sketchers of the same type, e.g. of different dimensions
+type mergeChecker interface {
+	checkMerge(Sketcher) error
+}
+
+func checkMerge(s, o Sketcher) error {
+	if c, ok := s.(mergeChecker); ok {
+		return c.checkMerge(o)
+	}
+	if reflect.TypeOf(s) != reflect.TypeOf(o) {
+		return fmt.Errorf("cannot merge %T into %T", o, s)
+	}
+	return nil
+}
+
+// Empty returns a ring with no slots but the same sketcher constructor as m,
+// it is meant to be filled by ReadFrom
+func (m *RingSketcher) Empty() *RingSketcher {
+	return &RingSketcher{newSketcher: m.newSketcher}
 }
 
+// WriteTo writes the ring in a versioned and checksummed frame if the type of
+// its sketchers is registered with RegisterSketcher, otherwise unframed to be
+// read by a ring with the same sketcher constructor
+func (s *RingSketcher) WriteTo(w io.Writer) (int64, error) {
+	return s.writeFrame(w, 0)
+}
+
+// WriteFrame writes the ring like WriteTo with the optional encodings
+// selected by flags, ReadFrom picks them from the frame. Flags need the type
+// of the sketchers to be registered.
+func (s *RingSketcher) WriteFrame(w io.Writer, flags FrameFlags) (int64, error) {
+	return s.writeFrame(w, flags)
+}
+
+// ReadFrom reads a ring written by WriteTo with the registered sketcher of its
+// type, or an unframed ring with the sketcher constructor of s. The slots of
+// s are left unchanged on error.
 func (s *RingSketcher) ReadFrom(r io.Reader) (int64, error) {
-	var err error
-	var nn int
-	n := 0
-	nn, err = binary.ReadInt64(r, &s.start)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	nn, err = binary.ReadInt64(r, &s.offset)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	var size int64
-	nn, err = binary.ReadInt64(r, &size)
-	if err != nil {
-		return int64(n), err
-	}
-	n += nn
-	s.a = make([]Sketcher, int(size))
+	return s.readFrame(r)
+}
+
+func (s *RingSketcher) writeRing(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.Encode(&s.ringIndex)
 	for i := range s.a {
-		s.a[i] = s.newSketcher()
-		nn, err := s.a[i].ReadFrom(r)
-		if err != nil {
-			return int64(n), err
-		}
-		n += int(nn)
+		enc.Encode(s.a[i])
 	}
-	return int64(n), nil
+	return enc.Flush()
+}
+
+// readRing reads the ring with the sketchers of newSketcher, which replaces
+// the constructor of s on success
+func (s *RingSketcher) readRing(r io.Reader, newSketcher func() Sketcher) (int64, error) {
+	dec := binary.NewDecoder(r)
+	var index ringIndex
+	dec.Decode(&index)
+	a := make([]Sketcher, 0, initialSlots(index.size))
+	for i := 0; i < index.size && dec.Err() == nil; i++ {
+		sk := newSketcher()
+		dec.Decode(sk)
+		a = append(a, sk)
+	}
+	if dec.Err() == nil {
+		s.ringIndex, s.a, s.newSketcher = index, a, newSketcher
+	}
+	return dec.Result()
 }
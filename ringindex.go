@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+
+	"h12.io/stats/binary"
+)
+
+// ringIndex maps offsets to the positions of a ring of size slots, it is
+// shared by all the rings of sketches
+type ringIndex struct {
+	start  int64
+	offset int64
+	size   int
+}
+
+// pos returns the position of offset or -1 if offset is out of the ring
+func (r *ringIndex) pos(offset int64) int {
+	if offset < r.offset || offset >= r.offset+int64(r.size) {
+		return -1
+	}
+	pos := int(r.start + offset - r.offset)
+	if pos >= r.size {
+		pos -= r.size
+	}
+	return pos
+}
+
+// clip limits [from, to] to the offsets in the ring
+func (r *ringIndex) clip(from, to int64) (int64, int64) {
+	if from < r.offset {
+		from = r.offset
+	}
+	if end := r.offset + int64(r.size) - 1; to > end {
+		to = end
+	}
+	return from, to
+}
+
+// rotate moves the ring forward until it covers offset, calling reset on
+// every position that is reused, and returns the position of offset or -1
+// if offset is older than the ring
+func (r *ringIndex) rotate(offset int64, reset func(pos int)) int {
+	if offset < r.offset {
+		return -1
+	}
+	if offset-r.offset >= 2*int64(r.size) {
+		for i := 0; i < r.size; i++ {
+			reset(i)
+		}
+		r.start = 0
+		r.offset = offset - int64(r.size) + 1
+	}
+	for offset >= r.offset+int64(r.size) {
+		reset(int(r.start))
+		r.start++
+		r.offset++
+		if int(r.start) == r.size {
+			r.start = 0
+		}
+	}
+	return r.pos(offset)
+}
+
+func (r *ringIndex) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt64(r.start)
+	enc.WriteInt64(r.offset)
+	enc.WriteInt64(int64(r.size))
+	return enc.Flush()
+}
+
+func (r *ringIndex) ReadFrom(rd io.Reader) (int64, error) {
+	dec := binary.NewDecoder(rd)
+	start := dec.ReadInt64()
+	offset := dec.ReadInt64()
+	size := dec.ReadInt64()
+	if dec.Err() == nil {
+		dec.Fail(checkRing(start, size))
+	}
+	if dec.Err() == nil {
+		r.start, r.offset, r.size = start, offset, int(size)
+	}
+	return dec.Result()
+}
+
+// initialSlots returns the capacity to decode the slots of a ring with, the
+// slots grow as they are decoded instead of trusting size
+func initialSlots(size int) int {
+	if size > 64 {
+		return 64
+	}
+	return size
+}
+
+// checkRing validates the size and start position of a ring read from a
+// stream
+func checkRing(start, size int64) error {
+	if err := binary.CheckLen(size, binary.MaxSliceLen); err != nil {
+		return err
+	}
+	if size == 0 || start < 0 || start >= size {
+		return fmt.Errorf("%w: ring start %d out of size %d", binary.ErrCorrupt, start, size)
+	}
+	return nil
+}
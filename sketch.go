@@ -1,24 +1,68 @@
 package stats
 
 import (
+	"fmt"
 	"io"
-
 	"math"
 
 	"h12.io/stats/binary"
 	"h12.io/stats/internal/cml"
 )
 
+// CMLOptions configures the Count-Min-Log sketches of a ring, see
+// NewCMLRingSketcherWithOptions
+type CMLOptions = cml.Options
+
 func NewCMLRingSketcher(ringSize int, elemCap int, startOffset int64) *RingSketcher {
+	return NewCMLRingSketcherWithOptions(ringSize, CMLOptions{Capacity: elemCap}, startOffset)
+}
+
+// NewCMLRingSketcherWithOptions creates a ring of Count-Min-Log sketches
+// configured by opt, the sketch of the i-th slot is seeded with opt.Seed+i
+func NewCMLRingSketcherWithOptions(ringSize int, opt CMLOptions, startOffset int64) *RingSketcher {
 	a := make([]Sketcher, ringSize)
+	seed := opt.Seed
 	for i := range a {
-		var err error
-		a[i], err = cml.New(elemCap, 0.001)
+		opt.Seed = seed + uint64(i)
+		sk, err := cml.NewWithOptions(opt)
 		if err != nil {
 			panic(err)
 		}
+		a[i] = CMLSketcher{sk}
+	}
+	return NewRingSketcher(startOffset, a, func() Sketcher { return CMLSketcher{&cml.Sketch{}} })
+}
+
+// CMLSketcher is a Sketcher backed by a Count-Min-Log sketch
+type CMLSketcher struct {
+	*cml.Sketch
+}
+
+func (s CMLSketcher) Merge(o Sketcher) error {
+	other, ok := o.(CMLSketcher)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into CMLSketcher", o)
+	}
+	return s.Sketch.Merge(other.Sketch)
+}
+
+func (s CMLSketcher) checkMerge(o Sketcher) error {
+	other, ok := o.(CMLSketcher)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into CMLSketcher", o)
+	}
+	return s.Sketch.CheckMerge(other.Sketch)
+}
+
+func (s CMLSketcher) Diagnostics() Diagnostics {
+	total := s.Total()
+	return Diagnostics{
+		FillRatio:     s.FillRatio(),
+		Total:         total,
+		ErrorBound:    s.Epsilon() * total,
+		RelativeError: s.RelativeError(),
+		MemoryBytes:   s.MemoryBytes(),
 	}
-	return NewRingSketcher(startOffset, a, func() Sketcher { return &cml.Sketch{} })
 }
 
 func NewMapRingSketcher(ringSize int, elemCap int, startOffset int64) *RingSketcher {
@@ -36,6 +80,8 @@ func NewMapRingSketcher(ringSize int, elemCap int, startOffset int64) *RingSketc
 	return NewRingSketcher(startOffset, a, func() Sketcher { return &Uint8MapSketcher{} })
 }
 
+// Uint8MapSketcher saturates at 255 and drops new keys once capLimit is
+// reached, see MapSketcher for wider counters and eviction
 type Uint8MapSketcher struct {
 	m        map[string]uint8
 	capLimit int32
@@ -52,6 +98,23 @@ func (s *Uint8MapSketcher) Get(key []byte) float64 {
 	return float64(s.m[string(key)])
 }
 
+// Add increases the count of key by n, saturating at 255
+func (s *Uint8MapSketcher) Add(key []byte, n uint64) {
+	if n == 0 {
+		return
+	}
+	k := string(key)
+	c, ok := s.m[k]
+	if !ok && len(s.m) >= int(s.capLimit) {
+		return
+	}
+	if n >= uint64(255-c) {
+		s.m[k] = 255
+		return
+	}
+	s.m[k] = c + uint8(n)
+}
+
 func (s *Uint8MapSketcher) Inc(key []byte) {
 	if len(s.m) >= int(s.capLimit) {
 		return
@@ -65,69 +128,65 @@ func (s *Uint8MapSketcher) Inc(key []byte) {
 	s.m[k]++
 }
 
+// Merge adds the counts of o, saturating at 255, new keys are ignored once
+// the capacity limit is reached
+func (s *Uint8MapSketcher) Merge(o Sketcher) error {
+	other, ok := o.(*Uint8MapSketcher)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into Uint8MapSketcher", o)
+	}
+	for k, v := range other.m {
+		c, ok := s.m[k]
+		if !ok && len(s.m) >= int(s.capLimit) {
+			continue
+		}
+		if sum := int(c) + int(v); sum < 255 {
+			s.m[k] = uint8(sum)
+		} else {
+			s.m[k] = 255
+		}
+	}
+	return nil
+}
+
+func (s *Uint8MapSketcher) Diagnostics() Diagnostics {
+	d := Diagnostics{}
+	if s.capLimit > 0 {
+		d.FillRatio = float64(len(s.m)) / float64(s.capLimit)
+	}
+	for k, v := range s.m {
+		d.Total += float64(v)
+		d.MemoryBytes += int64(len(k)) + mapEntryBytes
+	}
+	return d
+}
+
 func (s *Uint8MapSketcher) Reset() {
 	s.m = make(map[string]uint8)
 }
 
 func (s *Uint8MapSketcher) WriteTo(w io.Writer) (int64, error) {
-	var nn int
-	var err error
-	n := 0
-	nn, err = binary.WriteInt32(w, int32(s.capLimit))
-	n += nn
-	if err != nil {
-		return int64(n), err
-	}
-	nn, err = binary.WriteInt32(w, int32(len(s.m)))
-	n += nn
-	if err != nil {
-		return int64(n), err
-	}
+	enc := binary.NewEncoder(w)
+	enc.WriteInt32(s.capLimit)
+	enc.WriteInt32(int32(len(s.m)))
 	for k, v := range s.m {
-		nn, err = binary.WriteString(w, k)
-		n += nn
-		if err != nil {
-			return int64(n), err
-		}
-		nn, err = binary.WriteUint8(w, v)
-		n += nn
-		if err != nil {
-			return int64(n), err
-		}
+		enc.WriteString(k)
+		enc.WriteUint8(v)
 	}
-	return int64(n), nil
+	return enc.Flush()
 }
 
 func (s *Uint8MapSketcher) ReadFrom(r io.Reader) (int64, error) {
-	var nn int
-	var err error
-	n := 0
-	nn, err = binary.ReadInt32(r, &s.capLimit)
-	n += nn
-	if err != nil {
-		return int64(n), err
-	}
-	var size int32
-	nn, err = binary.ReadInt32(r, &size)
-	n += nn
-	if err != nil {
-		return int64(n), err
-	}
+	dec := binary.NewDecoder(r)
+	s.capLimit = dec.ReadInt32()
+	size := dec.ReadInt32()
 	s.m = make(map[string]uint8)
-	for i := 0; i < int(size); i++ {
-		var k string
-		var v uint8
-		nn, err = binary.ReadString(r, &k)
-		n += nn
-		if err != nil {
-			return int64(n), err
-		}
-		nn, err = binary.ReadUint8(r, &v)
-		n += nn
-		if err != nil {
-			return int64(n), err
+	for i := 0; i < int(size) && dec.Err() == nil; i++ {
+		k := dec.ReadString()
+		v := dec.ReadUint8()
+		if dec.Err() == nil {
+			s.m[k] = v
 		}
-		s.m[k] = v
 	}
-	return int64(n), nil
+	return dec.Result()
 }
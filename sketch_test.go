@@ -7,15 +7,18 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
 	"h12.io/gspec/util"
+	"h12.io/stats/internal/cml"
 )
 
 func TestSketch(t *testing.T) {
 	testSketch(t, NewCMLRingSketcher(24, 1000000, 0))
 	testSketch(t, NewMapRingSketcher(2, 1000000, 0))
+	testSketch(t, NewMapRingSketcherWithOptions(2, MapOptions{Capacity: 1000}, 0))
 }
 
 func testSketch(t *testing.T, s *RingSketcher) {
@@ -78,3 +81,97 @@ func TestMapSize(t *testing.T) {
 	}
 	fmt.Println(time.Since(start))
 }
+
+func TestSketchMerge(t *testing.T) {
+	for _, newRing := range []func(startOffset int64) *RingSketcher{
+		func(startOffset int64) *RingSketcher { return NewCMLRingSketcher(4, 1000000, startOffset) },
+		func(startOffset int64) *RingSketcher { return NewMapRingSketcher(4, 1000000, startOffset) },
+	} {
+		key := []byte("a")
+		s1 := newRing(0)
+		s2 := newRing(2)
+		for offset := int64(0); offset < 4; offset++ {
+			for i := 0; i < 10; i++ {
+				s1.Inc(offset, key)
+			}
+		}
+		for offset := int64(2); offset < 6; offset++ {
+			for i := 0; i < 20; i++ {
+				s2.Inc(offset, key)
+			}
+		}
+		if err := s1.Merge(s2); err != nil {
+			t.Fatal(err)
+		}
+		if s1.Offset() != 2 {
+			t.Fatalf("expect offset 2 got %d", s1.Offset())
+		}
+		for offset, expected := range map[int64]int{2: 30, 3: 30, 4: 20, 5: 20} {
+			if cnt := int(s1.Get(offset, key) + 0.5); cnt < expected-1 || cnt > expected+1 {
+				t.Fatalf("offset %d: expect %d got %d", offset, expected, cnt)
+			}
+		}
+	}
+	if err := NewCMLRingSketcher(1, 1000000, 0).Merge(NewMapRingSketcher(1, 1000000, 0)); err == nil {
+		t.Fatal("expect error merging different sketchers")
+	}
+	// a newer ring of other dimensions neither rotates nor changes the ring
+	s := NewCMRingSketcher(2, 0.1, 0.1, 0)
+	s.Inc(1, []byte("a"))
+	if err := s.Merge(NewCMRingSketcher(2, 0.01, 0.1, 4)); err == nil {
+		t.Fatal("expect error merging different dimensions")
+	}
+	if s.Offset() != 0 || s.Get(1, []byte("a")) != 1 {
+		t.Fatalf("expect the ring unchanged, offset %d", s.Offset())
+	}
+}
+
+func TestSketchAdd(t *testing.T) {
+	key := []byte("a")
+	{
+		s := NewMapRingSketcher(1, 1000, 0)
+		s.Add(0, key, 100)
+		s.Add(0, key, 100)
+		s.Inc(0, key)
+		if cnt := s.Get(0, key); cnt != 201 {
+			t.Fatal(cnt, 201)
+		}
+		s.Add(0, key, 100)
+		if cnt := s.Get(0, key); cnt != 255 {
+			t.Fatal(cnt, 255)
+		}
+	}
+	{
+		s := NewCMLRingSketcher(1, 1000000, 0)
+		for i := 0; i < 100; i++ {
+			s.Add(0, key, 1000)
+		}
+		s.Add(0, []byte("b"), 7)
+		if cnt := s.Get(0, key); cnt < 95000 || cnt > 105000 {
+			t.Fatal(cnt, 100000)
+		}
+		if cnt := int(s.Get(0, []byte("b")) + 0.5); cnt < 6 || cnt > 8 {
+			t.Fatal(cnt, 7)
+		}
+	}
+}
+
+func TestCMLOptions(t *testing.T) {
+	opt := CMLOptions{Width: 1000, Depth: 4, LogBase: 1.001, Seed: 42}
+	newRing := func() *RingSketcher { return NewCMLRingSketcherWithOptions(2, opt, 0) }
+	s1, s2 := newRing(), newRing()
+	for i := 0; i < 5000; i++ {
+		key := []byte(strconv.Itoa(i % 100))
+		s1.Inc(1, key)
+		s2.Inc(1, key)
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(strconv.Itoa(i))
+		if s1.Get(1, key) != s2.Get(1, key) {
+			t.Fatalf("expect reproducible counts, got %v and %v", s1.Get(1, key), s2.Get(1, key))
+		}
+	}
+	if _, err := cml.NewWithOptions(CMLOptions{LogBase: 0.5}); err == nil {
+		t.Fatal("expect error for log base below 1")
+	}
+}
@@ -2,8 +2,11 @@ package stats
 
 import (
 	"encoding/json"
+	"io"
 	"sync"
 	"time"
+
+	"h12.io/stats/binary"
 )
 
 var DefaultBufferSize = 60
@@ -49,21 +52,52 @@ func (s *S) Merge(o *S, start time.Time) {
 }
 
 func (s *S) MergeWithTags(o *S, start time.Time, tags Tags) error {
+	return s.MergeWithTagsShift(o, start, tags, 0)
+}
+
+// MergeWithTagsShift is like MergeWithTags but moves every second of o by
+// shift, rounded to seconds, e.g. -2s for o from a host whose clock is 2
+// seconds ahead
+func (s *S) MergeWithTagsShift(o *S, start time.Time, tags Tags, shift time.Duration) error {
+	return s.MergeFunc(o, start, shift, func(keyTags Tags) Tags {
+		for k, v := range tags {
+			keyTags[k] = v
+		}
+		return keyTags
+	})
+}
+
+// MergeFunc is like MergeWithTagsShift but the tags of every meter of o are
+// replaced by the result of f, a meter is skipped if f returns nil
+func (s *S) MergeFunc(o *S, start time.Time, shift time.Duration, f func(Tags) Tags) error {
+	shiftSec := int(shift.Round(time.Second) / time.Second)
 	o.mu.RLock() // lock o during reading
+	defer o.mu.RUnlock()
 	for key, meter := range o.Meters {
 		name, keyTags, err := key.Decode()
 		if err != nil {
 			return err
 		}
-		for k, v := range tags {
-			keyTags[k] = v
+		if keyTags = f(keyTags); keyTags == nil {
+			continue
 		}
-		s.meter(NewKey(name, keyTags), start).Merge(meter)
+		s.meter(NewKey(name, keyTags), start).MergeShift(meter, shiftSec)
 	}
-	o.mu.RUnlock()
 	return nil
 }
 
+// Range returns a copy of s with every meter cut to the seconds within [from, to)
+func (s *S) Range(from, to time.Time) *S {
+	r := New()
+	s.mu.RLock()
+	r.defaultBufSize = s.defaultBufSize
+	for key, meter := range s.Meters {
+		r.Meters[key] = meter.Range(int(from.Unix()), int(to.Unix()))
+	}
+	s.mu.RUnlock()
+	return r
+}
+
 func (s *S) SetBufSize(defaultBufSize int) *S {
 	s.mu.Lock()
 	s.defaultBufSize = defaultBufSize
@@ -71,7 +105,75 @@ func (s *S) SetBufSize(defaultBufSize int) *S {
 	return s
 }
 
+// BufSize returns the number of seconds of the meters created by s
+func (s *S) BufSize() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultBufSize
+}
+
 func (s *S) String() string {
 	buf, _ := json.Marshal(s)
 	return string(buf)
 }
+
+func (s *S) WriteTo(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.writeMeters(w)
+}
+
+// WriteFrame writes s like WriteTo within a checksummed frame with the
+// optional encodings selected by flags
+func (s *S) WriteFrame(w io.Writer, flags FrameFlags) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return writeSnapshot(w, flags, encoderFunc(s.writeMeters))
+}
+
+// ReadFrom reads the meters written by WriteTo or WriteFrame into s, s is
+// left unchanged on error
+func (s *S) ReadFrom(r io.Reader) (int64, error) {
+	meters := make(map[Key]*Meter)
+	n, err := readSnapshot(r, decoderFunc(func(r io.Reader) (int64, error) {
+		return readMeters(r, meters)
+	}))
+	if err != nil {
+		return n, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Meters == nil {
+		s.Meters = make(map[Key]*Meter)
+	}
+	for key, meter := range meters {
+		s.Meters[key] = meter
+	}
+	return n, nil
+}
+
+func (s *S) writeMeters(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt64(int64(len(s.Meters)))
+	for key, meter := range s.Meters {
+		enc.WriteString(string(key))
+		enc.Encode(meter)
+	}
+	return enc.Flush()
+}
+
+func readMeters(r io.Reader, meters map[Key]*Meter) (int64, error) {
+	dec := binary.NewDecoder(r)
+	size := dec.ReadInt64()
+	for i := int64(0); i < size && dec.Err() == nil; i++ {
+		key := dec.ReadString()
+		meter := &Meter{}
+		dec.Decode(meter)
+		// the empty meters of the keys idle within S.Range have no
+		// seconds to merge
+		if dec.Err() == nil && len(meter.a) > 0 {
+			meters[Key(key)] = meter
+		}
+	}
+	return dec.Result()
+}
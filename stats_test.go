@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"bytes"
 	"encoding/json"
 	"reflect"
 	"strconv"
@@ -73,3 +74,40 @@ func TestStatsMergeWithTags(t *testing.T) {
 		t.Fatalf("expect %s got %s", expected, actual)
 	}
 }
+
+func TestStatsBinary(t *testing.T) {
+	testTime := time.Now()
+	s := New().SetBufSize(2)
+	s.Meter("test", Tags{"host": "a"}).Inc(testTime, 1)
+	s.Meter("test", Tags{"host": "a"}).Inc(testTime.Add(time.Second), 2)
+
+	var buf bytes.Buffer
+	n, err := s.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != buf.Len() {
+		t.Fatal("size mismatch", n, buf.Len())
+	}
+	actual := New().SetBufSize(2)
+	if _, err := actual.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if actual.String() != s.String() {
+		t.Fatalf("expect %s got %s", s.String(), actual.String())
+	}
+}
+
+func TestStatsRange(t *testing.T) {
+	testTime := time.Now()
+	s := New().SetBufSize(3)
+	s.Meter("test", nil).Inc(testTime, 1)
+	s.Meter("test", nil).Inc(testTime.Add(time.Second), 2)
+	s.Meter("test", nil).Inc(testTime.Add(2*time.Second), 3)
+
+	actual := s.Range(testTime.Add(time.Second), testTime.Add(2*time.Second)).String()
+	expected := `{"meters":{"test":[` + unixStr(testTime.Add(time.Second)) + `,2]}}`
+	if actual != expected {
+		t.Fatalf("expect %s got %s", expected, actual)
+	}
+}
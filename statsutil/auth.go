@@ -0,0 +1,120 @@
+package statsutil
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+func authHandler(h http.Handler, opt *Options) http.Handler {
+	if opt.BearerToken == "" && opt.Username == "" && opt.Password == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !opt.authorized(req) {
+			if opt.BearerToken == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="stats"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="stats"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (opt *Options) authorized(req *http.Request) bool {
+	if opt.BearerToken != "" {
+		auth := req.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") && secureEqual(strings.TrimPrefix(auth, "Bearer "), opt.BearerToken) {
+			return true
+		}
+	}
+	if opt.Username != "" || opt.Password != "" {
+		user, password, ok := req.BasicAuth()
+		if ok && secureEqual(user, opt.Username) && secureEqual(password, opt.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// pullClient returns a client that only follows redirects to allowed URLs
+func (opt *Options) pullClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !opt.pullAllowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// parsePullAllow splits PullAllow into URL and host patterns, a URL pattern
+// that fails to parse or has no host allows nothing
+func (opt *Options) parsePullAllow() {
+	opt.pullURLs, opt.pullHosts = nil, nil
+	for _, pattern := range opt.PullAllow {
+		if !strings.Contains(pattern, "://") {
+			opt.pullHosts = append(opt.pullHosts, pattern)
+			continue
+		}
+		u, err := url.Parse(pattern)
+		if err != nil || u.Host == "" || u.User != nil {
+			continue
+		}
+		opt.pullURLs = append(opt.pullURLs, u)
+	}
+}
+
+// pullAllowed reports whether u matches a pattern of PullAllow. A URL
+// pattern requires the same scheme and host and a path within the pattern
+// path, URLs with user info are never allowed.
+func (opt *Options) pullAllowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	for _, pattern := range opt.pullURLs {
+		if u.Scheme == pattern.Scheme && u.Host == pattern.Host && pathWithin(u.Path, pattern.Path) {
+			return true
+		}
+	}
+	for _, pattern := range opt.pullHosts {
+		if ok, _ := path.Match(pattern, u.Host); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, u.Hostname()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether p is prefix or below it, the comparison is at
+// the boundaries of the path segments after resolving dot segments
+func pathWithin(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	p = path.Clean("/" + p)
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,312 @@
+package statsutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"h12.io/stats"
+)
+
+const (
+	DefaultGenerations = 3
+
+	checkpointPrefix = "checkpoint-"
+	checkpointTemp   = ".tmp-"
+	statsFile        = "stats.bin"
+	ringFilePrefix   = "ring-"
+)
+
+// Checkpointer periodically writes S and the registered rings to a
+// directory and restores them on startup, so that a restart does not lose
+// them.
+//
+// Every checkpoint is a generation, a subdirectory written under a temporary
+// name and renamed when complete, so that a crash never leaves a partial
+// generation. Restore reads the newest generation that is complete and
+// falls back to the older ones.
+type Checkpointer struct {
+	Dir         string
+	Generations int              // generations kept, DefaultGenerations when 0
+	Flags       stats.FrameFlags // encodings of the S and ring frames
+
+	s     *stats.S
+	rings map[string]checkpointRing
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+type checkpointRing struct {
+	ring *stats.SyncRingSketcher
+	slot time.Duration
+}
+
+// NewCheckpointer creates a Checkpointer that writes s to dir
+func NewCheckpointer(s *stats.S, dir string) *Checkpointer {
+	return &Checkpointer{
+		Dir:   dir,
+		s:     s,
+		rings: make(map[string]checkpointRing),
+		now:   time.Now,
+	}
+}
+
+// AddRing registers a ring to be checkpointed by name. slot is the duration
+// of an offset as in TimeRingSketcher, the slots that aged out of the ring
+// by the time of Restore are discarded, offsets are kept as they are if slot
+// is 0.
+func (c *Checkpointer) AddRing(name string, ring *stats.SyncRingSketcher, slot time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rings[name] = checkpointRing{ring: ring, slot: slot}
+}
+
+// Checkpoint writes a new generation and removes the generations beyond
+// Generations
+func (c *Checkpointer) Checkpoint() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(c.Dir, checkpointTemp)
+	if err != nil {
+		return err
+	}
+	if err := c.write(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	name := filepath.Join(c.Dir, fmt.Sprintf("%s%020d", checkpointPrefix, c.now().UnixNano()))
+	if err := os.Rename(tmp, name); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	syncDir(c.Dir)
+	return c.prune()
+}
+
+func (c *Checkpointer) write(dir string) error {
+	if err := c.writeFrame(filepath.Join(dir, statsFile), c.s); err != nil {
+		return err
+	}
+	for name, r := range c.rings {
+		if err := c.writeFrame(filepath.Join(dir, ringFileName(name)), r.ring); err != nil {
+			return fmt.Errorf("ring %s: %w", name, err)
+		}
+	}
+	syncDir(dir)
+	return nil
+}
+
+// writeFrame writes S or a ring to a file. It is serialized into memory
+// first, so that the lock of v is not held while the file is written and
+// synced.
+func (c *Checkpointer) writeFrame(name string, v interface {
+	WriteFrame(io.Writer, stats.FrameFlags) (int64, error)
+}) error {
+	var buf bytes.Buffer
+	if _, err := v.WriteFrame(&buf, c.Flags); err != nil {
+		return err
+	}
+	return writeFile(name, buf.Bytes())
+}
+
+func writeFile(name string, data []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename within dir durable, it is best effort as not every
+// platform can sync a directory
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+func ringFileName(name string) string {
+	return ringFilePrefix + url.PathEscape(name) + ".bin"
+}
+
+// generations returns the paths of the generations in Dir, the newest first
+func (c *Checkpointer) generations() ([]string, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), checkpointPrefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	// the fixed width timestamps sort as strings
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for i, name := range names {
+		names[i] = filepath.Join(c.Dir, name)
+	}
+	return names, nil
+}
+
+func (c *Checkpointer) prune() error {
+	gens, err := c.generations()
+	if err != nil {
+		return err
+	}
+	keep := c.Generations
+	if keep <= 0 {
+		keep = DefaultGenerations
+	}
+	for len(gens) > keep {
+		if err := os.RemoveAll(gens[len(gens)-1]); err != nil {
+			return err
+		}
+		gens = gens[:len(gens)-1]
+	}
+	return nil
+}
+
+// Restore merges the newest generation that can be restored into S and the
+// registered rings, the seconds and slots that aged out of their windows are
+// discarded. Generations that fail to read or whose rings do not match the
+// registered ones are skipped, an error is returned if none of them can be
+// restored. The leftovers of an interrupted checkpoint are removed.
+func (c *Checkpointer) Restore() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.removeTemp(); err != nil {
+		return err
+	}
+	gens, err := c.generations()
+	if err != nil {
+		return err
+	}
+	now := c.now()
+	var errs []string
+	for _, gen := range gens {
+		s, rings, err := c.load(gen, now)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", filepath.Base(gen), err))
+			continue
+		}
+		// checked by load, Merge only fails for a Sketcher whose Merge
+		// fails for reasons CheckMerge does not know
+		for name, ring := range rings {
+			if err := c.rings[name].ring.Merge(ring); err != nil {
+				return fmt.Errorf("ring %s: %w", name, err)
+			}
+		}
+		start := now.Add(-time.Duration(c.s.BufSize()) * time.Second)
+		c.s.Merge(s, start)
+		return nil
+	}
+	if len(errs) > 0 {
+		return errors.New("no checkpoint restored: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// load reads every file of a generation and checks that the rings can be
+// merged before any of them is merged, so that a generation that cannot be
+// restored leaves S and the rings untouched
+func (c *Checkpointer) load(gen string, now time.Time) (*stats.S, map[string]*stats.RingSketcher, error) {
+	s := stats.New()
+	if err := readFile(filepath.Join(gen, statsFile), s); err != nil {
+		return nil, nil, err
+	}
+	rings := make(map[string]*stats.RingSketcher)
+	for name, r := range c.rings {
+		ring := r.ring.Empty()
+		if err := readFile(filepath.Join(gen, ringFileName(name)), ring); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// registered after the checkpoint
+				continue
+			}
+			return nil, nil, fmt.Errorf("ring %s: %w", name, err)
+		}
+		if ring.Len() != r.ring.Len() {
+			return nil, nil, fmt.Errorf("ring %s: %d slots, expect %d", name, ring.Len(), r.ring.Len())
+		}
+		if err := r.ring.CheckMerge(ring); err != nil {
+			return nil, nil, fmt.Errorf("ring %s: %w", name, err)
+		}
+		if r.slot > 0 {
+			ring.Advance(stats.NewTimeRingSketcher(ring, r.slot).Offset(now))
+		}
+		rings[name] = ring
+	}
+	return s, rings, nil
+}
+
+func readFile(name string, v io.ReaderFrom) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = v.ReadFrom(bufio.NewReader(f))
+	return err
+}
+
+func (c *Checkpointer) removeTemp() error {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), checkpointTemp) {
+			if err := os.RemoveAll(filepath.Join(c.Dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run calls Checkpoint every interval until stop is closed and once more
+// after, errors are passed to onError if it is not nil
+func (c *Checkpointer) Run(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if err := c.Checkpoint(); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package statsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+)
+
+func newCheckpointRing() *stats.SyncRingSketcher {
+	return stats.NewSyncRingSketcher(stats.NewMapRingSketcherWithOptions(4, stats.MapOptions{Capacity: 10}, 0))
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	key := []byte("a")
+
+	s := stats.New()
+	s.Meter("m", nil).Inc(now, 2)
+	ring := newCheckpointRing()
+	offset := stats.NewTimeRingSketcher(nil, time.Second).Offset(now)
+	ring.Add(offset, key, 3)
+	c := NewCheckpointer(s, dir)
+	c.Flags = stats.FrameVarint | stats.FrameFlate
+	c.AddRing("r/1", ring, time.Second)
+	for i := 0; i < 5; i++ {
+		c.now = func() time.Time { return now.Add(time.Duration(i) * time.Millisecond) }
+		if err := c.Checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gens, err := c.generations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gens) != DefaultGenerations {
+		t.Fatalf("expect %d generations got %d", DefaultGenerations, len(gens))
+	}
+
+	restore := func(after time.Duration) (*stats.S, *stats.SyncRingSketcher) {
+		s := stats.New()
+		ring := newCheckpointRing()
+		c := NewCheckpointer(s, dir)
+		c.AddRing("r/1", ring, time.Second)
+		c.now = func() time.Time { return now.Add(after) }
+		if err := c.Restore(); err != nil {
+			t.Fatal(err)
+		}
+		return s, ring
+	}
+
+	s, ring = restore(2 * time.Second)
+	if v := s.Meter("m", nil).Get(int(now.Unix())); v != 2 {
+		t.Fatalf("expect 2 got %d", v)
+	}
+	if v := ring.Get(offset, key); v != 3 {
+		t.Fatalf("expect 3 got %v", v)
+	}
+
+	// aged out of the windows
+	s, ring = restore(2 * time.Minute)
+	if v := s.Meter("m", nil).Get(int(now.Unix())); v != 0 {
+		t.Fatalf("expect 0 got %d", v)
+	}
+	if v := ring.Get(offset, key); v != 0 {
+		t.Fatalf("expect 0 got %v", v)
+	}
+}
+
+func TestCheckpointFallback(t *testing.T) {
+	dir := t.TempDir()
+	s := stats.New()
+	s.Meter("m", nil).Inc(time.Now(), 1)
+	ring := newCheckpointRing()
+	ring.Add(1, []byte("a"), 1)
+	c := NewCheckpointer(s, dir)
+	c.AddRing("r", ring, 0)
+	if err := c.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	ring.Add(1, []byte("a"), 1)
+	if err := c.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	gens, err := c.generations()
+	if err != nil || len(gens) != 2 {
+		t.Fatalf("expect 2 generations got %v: %v", gens, err)
+	}
+	// a corrupt newest generation and the leftover of an interrupted
+	// checkpoint
+	if err := os.WriteFile(filepath.Join(gens[0], ringFileName("r")), []byte("SKRG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	temp := filepath.Join(dir, checkpointTemp+"1")
+	if err := os.Mkdir(temp, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newCheckpointRing()
+	c = NewCheckpointer(stats.New(), dir)
+	c.AddRing("r", restored, 0)
+	if err := c.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if v := restored.Get(1, []byte("a")); v != 1 {
+		t.Fatalf("expect the older generation with 1, got %v", v)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Fatalf("expect temporary directory removed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(gens[1], statsFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Restore(); err == nil {
+		t.Fatal("expect error when no generation can be read")
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s := stats.New()
+	s.Meter("m", nil).Inc(time.Now(), 1)
+	a, b := newCheckpointRing(), newCheckpointRing()
+	a.Add(1, []byte("a"), 1)
+	b.Add(1, []byte("b"), 1)
+	c := NewCheckpointer(s, dir)
+	c.AddRing("a", a, 0)
+	c.AddRing("b", b, 0)
+	if err := c.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// b is restored into a ring of another sketcher type
+	restored := stats.New()
+	ra := newCheckpointRing()
+	rb := stats.NewSyncRingSketcher(stats.NewCMRingSketcher(4, 0.1, 0.1, 0))
+	c = NewCheckpointer(restored, dir)
+	c.AddRing("a", ra, 0)
+	c.AddRing("b", rb, 0)
+	if err := c.Restore(); err == nil {
+		t.Fatal("expect error for a ring of another type")
+	}
+	if len(restored.Meters) != 0 || ra.Get(1, []byte("a")) != 0 {
+		t.Fatal("expect nothing restored")
+	}
+}
+
+func TestCheckpointRun(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCheckpointer(stats.New(), dir)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(time.Hour, stop, func(err error) { t.Error(err) })
+		close(done)
+	}()
+	close(stop)
+	<-done
+	// checkpointed once on stop
+	gens, err := c.generations()
+	if err != nil || len(gens) != 1 {
+		t.Fatalf("expect 1 generation got %v: %v", gens, err)
+	}
+
+	// a file in place of the directory fails every checkpoint
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c = NewCheckpointer(stats.New(), file)
+	stop = make(chan struct{})
+	done = make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		c.Run(time.Millisecond, stop, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+		close(done)
+	}()
+	if err := <-errs; err == nil {
+		t.Fatal("expect error")
+	}
+	close(stop)
+	<-done
+}
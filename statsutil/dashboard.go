@@ -0,0 +1,20 @@
+package statsutil
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the embedded HTML dashboard, which reads the vars
+// route next to it
+func dashboardHandler(prefix string) http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(prefix, http.FileServer(http.FS(files)))
+}
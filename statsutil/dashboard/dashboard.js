@@ -0,0 +1,119 @@
+(function() {
+  var width = 600, height = 60, timer = null;
+
+  // a key is "name tag1=v1&tag2=v2", see stats.NewKey
+  function decodeKey(key) {
+    var i = key.indexOf(" ");
+    if (i < 0) {
+      return {name: key, tags: {}, tagText: ""};
+    }
+    var tags = {};
+    new URLSearchParams(key.slice(i + 1)).forEach(function(v, k) { tags[k] = v; });
+    return {name: key.slice(0, i), tags: tags, tagText: key.slice(i + 1).replace(/&/g, " ")};
+  }
+
+  function parseFilter(text) {
+    var filter = {};
+    text.split(/\s+/).forEach(function(part) {
+      var i = part.indexOf("=");
+      if (i > 0) {
+        filter[part.slice(0, i)] = part.slice(i + 1);
+      }
+    });
+    return filter;
+  }
+
+  function matches(tags, filter) {
+    for (var k in filter) {
+      if (tags[k] !== filter[k]) {
+        return false;
+      }
+    }
+    return true;
+  }
+
+  // a meter is [startSec, v0, v1, ...], see stats.Meter.MarshalJSON
+  function plot(values) {
+    var svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+    svg.setAttribute("width", width);
+    svg.setAttribute("height", height);
+    var max = Math.max.apply(null, values.concat([1]));
+    var step = values.length > 1 ? width / (values.length - 1) : 0;
+    var points = values.map(function(v, i) {
+      return (i * step).toFixed(1) + "," + (height - 2 - v / max * (height - 4)).toFixed(1);
+    });
+    var line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.appendChild(line);
+    var title = document.createElementNS("http://www.w3.org/2000/svg", "title");
+    title.textContent = "max " + max;
+    svg.appendChild(title);
+    return svg;
+  }
+
+  function render(data) {
+    var filter = parseFilter(document.getElementById("filter").value);
+    var groups = {};
+    Object.keys(data.meters || {}).sort().forEach(function(key) {
+      var k = decodeKey(key);
+      if (!matches(k.tags, filter)) {
+        return;
+      }
+      (groups[k.name] = groups[k.name] || []).push({key: k, values: data.meters[key].slice(1)});
+    });
+    var main = document.getElementById("meters");
+    main.textContent = "";
+    Object.keys(groups).sort().forEach(function(name) {
+      var section = document.createElement("section");
+      var h2 = document.createElement("h2");
+      h2.textContent = name;
+      section.appendChild(h2);
+      groups[name].forEach(function(m) {
+        var row = document.createElement("div");
+        row.className = "meter";
+        var tags = document.createElement("span");
+        tags.className = "tags";
+        tags.textContent = m.key.tagText || "-";
+        tags.title = m.key.tagText;
+        var sum = document.createElement("span");
+        sum.className = "sum";
+        sum.textContent = m.values.reduce(function(a, b) { return a + b; }, 0);
+        sum.title = "sum over the window";
+        row.appendChild(tags);
+        row.appendChild(sum);
+        row.appendChild(plot(m.values));
+        section.appendChild(row);
+      });
+      main.appendChild(section);
+    });
+  }
+
+  var last = {};
+  function refresh() {
+    fetch("../vars", {credentials: "same-origin"}).then(function(resp) {
+      if (!resp.ok) {
+        throw new Error(resp.status + " " + resp.statusText);
+      }
+      return resp.json();
+    }).then(function(data) {
+      document.getElementById("status").textContent = "";
+      last = data;
+      render(data);
+    }).catch(function(err) {
+      document.getElementById("status").textContent = err.message;
+    });
+  }
+
+  function schedule() {
+    clearInterval(timer);
+    var interval = +document.getElementById("refresh").value;
+    if (interval > 0) {
+      timer = setInterval(refresh, interval);
+    }
+  }
+
+  document.getElementById("filter").addEventListener("input", function() { render(last); });
+  document.getElementById("refresh").addEventListener("change", schedule);
+  refresh();
+  schedule();
+})();
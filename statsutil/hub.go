@@ -1,19 +1,48 @@
 package statsutil
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 	"h12.io/stats"
 )
 
+const (
+	// TimeHeader is the header in which the vars route returns the server
+	// time in Unix nanoseconds, it is used to estimate the clock skew of a
+	// host
+	TimeHeader = "X-Stats-Time"
+
+	// TagsHeader is the header in which the vars route returns the tags of
+	// the server in URL query form, e.g. "dc=sg&role=web"
+	TagsHeader = "X-Stats-Tags"
+)
+
 type Host struct {
 	URLs  []string
 	Tag   string
 	Delay time.Duration
+
+	// Tags are added to every meter of the host besides "host": Tag
+	Tags stats.Tags
+
+	// DiscoverTags adds the tags returned in TagsHeader by the host, Tags
+	// take precedence over them
+	DiscoverTags bool
+
+	// Relabel rules are applied to the tags of every meter in order after
+	// all the tags above are added
+	Relabel []RelabelRule
+
+	// Skew is set by CollectStats to the clock offset of the host estimated
+	// from TimeHeader and the round trip time, the seconds of the host are
+	// moved by -Skew when merged. It is 0 if the host does not return
+	// TimeHeader.
+	Skew time.Duration
 }
 
 func CollectStats(httpClient *http.Client, hosts []Host, start time.Time) (*stats.S, error) {
@@ -22,35 +51,68 @@ func CollectStats(httpClient *http.Client, hosts []Host, start time.Time) (*stat
 	for i := range hosts {
 		host := &hosts[i]
 		g.Go(func() error {
-			s, err := host.get(httpClient)
+			relabelers, err := compileRelabel(host.Relabel)
+			if err != nil {
+				return fmt.Errorf("%s: %v", host.Tag, err)
+			}
+			s, discovered, err := host.get(httpClient)
 			if err != nil {
 				return err
 			}
-			return allStats.MergeWithTags(s, start.Add(-host.Delay), stats.Tags{"host": host.Tag})
+			return allStats.MergeFunc(s, start.Add(-host.Delay), -host.Skew, func(tags stats.Tags) stats.Tags {
+				for k, v := range discovered {
+					tags[k] = v
+				}
+				for k, v := range host.Tags {
+					tags[k] = v
+				}
+				tags["host"] = host.Tag
+				return relabel(relabelers, tags)
+			})
 		})
 	}
 	return allStats, g.Wait()
 }
 
-func (h *Host) get(client *http.Client) (*stats.S, error) {
+func (h *Host) get(client *http.Client) (*stats.S, stats.Tags, error) {
 	var (
-		resp *http.Response
-		err  error
+		resp  *http.Response
+		err   error
+		begin time.Time
+		end   time.Time
 	)
 	for _, uri := range h.URLs {
+		begin = time.Now()
 		resp, err = client.Get(uri)
+		end = time.Now()
 		if err != nil {
 			continue
 		}
 		break
 	}
 	if err != nil {
-		return nil, fmt.Errorf("%s: %v", err.Error(), h.URLs)
+		return nil, nil, fmt.Errorf("%s: %v", err.Error(), h.URLs)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%d: %v", resp.StatusCode, h.URLs)
+		return nil, nil, fmt.Errorf("%d: %v", resp.StatusCode, h.URLs)
+	}
+	h.Skew = 0
+	if ns, err := strconv.ParseInt(resp.Header.Get(TimeHeader), 10, 64); err == nil {
+		// assume the server time is taken in the middle of the round trip
+		h.Skew = time.Unix(0, ns).Sub(begin.Add(end.Sub(begin) / 2))
+	}
+	var tags stats.Tags
+	if h.DiscoverTags {
+		values, err := url.ParseQuery(resp.Header.Get(TagsHeader))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", TagsHeader, err)
+		}
+		tags = make(stats.Tags)
+		for k := range values {
+			tags[k] = values.Get(k)
+		}
 	}
 	s := stats.New()
-	return s, json.NewDecoder(resp.Body).Decode(s)
+	return s, tags, decodeStats(resp.Header.Get("Content-Type"), resp.Body, s)
 }
@@ -0,0 +1,35 @@
+package statsutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+)
+
+func TestCollectStatsSkew(t *testing.T) {
+	skew := 3 * time.Second
+	now := time.Now().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(TimeHeader, strconv.FormatInt(time.Now().Add(skew).UnixNano(), 10))
+		fmt.Fprintf(w, `{"meters":{"test":[%d,1]}}`, now.Add(skew).Unix())
+	}))
+	defer server.Close()
+
+	hosts := []Host{{Tag: "a", URLs: []string{server.URL}}}
+	s, err := CollectStats(http.DefaultClient, hosts, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := hosts[0].Skew - skew; d > 100*time.Millisecond || d < -100*time.Millisecond {
+		t.Fatalf("expect skew about %v got %v", skew, hosts[0].Skew)
+	}
+	meter := s.Meters[stats.NewKey("test", stats.Tags{"host": "a"})]
+	if v := meter.Get(int(now.Unix())); v != 1 {
+		t.Fatalf("expect 1 at %d got %v", now.Unix(), meter)
+	}
+}
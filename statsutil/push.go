@@ -0,0 +1,126 @@
+package statsutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"h12.io/stats"
+)
+
+// Pusher periodically sends the completed seconds of S to the push route of
+// an aggregator, seconds not yet acknowledged are sent again on the next push
+type Pusher struct {
+	Client  *http.Client
+	URL     string
+	Tags    stats.Tags
+	Binary  bool
+	Token   string // bearer token, basic auth can be given in URL
+	Retries int
+	Backoff time.Duration
+
+	s    *stats.S
+	last time.Time
+	mu   sync.Mutex
+}
+
+// NewPusher creates a Pusher that pushes s to url, only seconds completed
+// after its creation are pushed
+func NewPusher(s *stats.S, url string, tags stats.Tags) *Pusher {
+	return &Pusher{
+		Client:  http.DefaultClient,
+		URL:     url,
+		Tags:    tags,
+		Retries: 3,
+		Backoff: time.Second,
+		s:       s,
+		last:    time.Now().Truncate(time.Second),
+	}
+}
+
+// Push sends the seconds completed since the last successful push
+func (p *Pusher) Push() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().Truncate(time.Second)
+	if !now.After(p.last) {
+		return nil
+	}
+	body, contentType, err := p.encode(p.s.Range(p.last, now))
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		err = p.post(body, contentType)
+		if err == nil {
+			p.last = now
+			return nil
+		}
+		if i >= p.Retries {
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * p.Backoff)
+	}
+}
+
+// Run calls Push every interval until stop is closed, errors are passed to
+// onError if it is not nil
+func (p *Pusher) Run(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := p.Push(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (p *Pusher) encode(s *stats.S) ([]byte, string, error) {
+	if p.Binary {
+		var buf bytes.Buffer
+		if _, err := s.WriteTo(&buf); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), binaryContentType, nil
+	}
+	buf, err := json.Marshal(s)
+	return buf, "application/json", err
+}
+
+func (p *Pusher) post(body []byte, contentType string) error {
+	uri, err := url.Parse(p.URL)
+	if err != nil {
+		return err
+	}
+	query := uri.Query()
+	for k, v := range p.Tags {
+		query.Set(k, v)
+	}
+	uri.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPost, uri.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%d: %s", resp.StatusCode, p.URL)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package statsutil
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+)
+
+func TestPush(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		aggregated := stats.New()
+		server := httptest.NewServer(Handler(aggregated, "/"))
+
+		s := stats.New()
+		p := NewPusher(s, server.URL+"/push", stats.Tags{"host": "a"})
+		p.Binary = binary
+		p.last = p.last.Add(-2 * time.Second)
+		// idle is out of the pushed range, so it is pushed as an empty meter
+		jsonText := `{"meters":{"test":[` + strconv.Itoa(int(p.last.Unix())) + `,1,2],` +
+			`"idle":[` + strconv.Itoa(int(p.last.Unix())-1000) + `,1]}}`
+		if err := json.Unmarshal([]byte(jsonText), s); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Push(); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+
+		meter, ok := aggregated.Meters[stats.NewKey("test", stats.Tags{"host": "a", DefaultOriginTag: "127.0.0.1"})]
+		if !ok {
+			t.Fatal("pushed meter not found", aggregated)
+		}
+		sec := int(p.last.Unix())
+		if v := meter.Get(sec-2) + meter.Get(sec-1); v != 3 {
+			t.Fatalf("expect 3 got %d", v)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package statsutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"h12.io/stats"
+)
+
+// Relabel actions
+const (
+	RelabelReplace = "replace"
+	RelabelRename  = "rename"
+	RelabelDrop    = "drop"
+)
+
+// RelabelRule rewrites the tags of a meter during merge.
+//
+// replace (the default action) joins the values of Source with ";", and if
+// Regex matches the joined value, sets Target to Replacement with $1, ${name}
+// etc. expanded from the match. rename moves the single tag in Source to
+// Target. drop deletes the tags in Source whose values match Regex.
+// An empty Regex matches any value.
+type RelabelRule struct {
+	Action      string   `json:"action" yaml:"action"`
+	Source      []string `json:"source" yaml:"source"`
+	Target      string   `json:"target" yaml:"target"`
+	Regex       string   `json:"regex" yaml:"regex"`
+	Replacement string   `json:"replacement" yaml:"replacement"`
+}
+
+type relabeler struct {
+	rule *RelabelRule
+	re   *regexp.Regexp
+}
+
+func compileRelabel(rules []RelabelRule) ([]relabeler, error) {
+	relabelers := make([]relabeler, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		regex := rule.Regex
+		if regex == "" {
+			regex = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return nil, err
+		}
+		switch rule.Action {
+		case "", RelabelReplace:
+			if rule.Target == "" {
+				return nil, fmt.Errorf("relabel rule %d: missing target", i)
+			}
+		case RelabelRename:
+			if len(rule.Source) != 1 || rule.Target == "" {
+				return nil, fmt.Errorf("relabel rule %d: rename needs one source and a target", i)
+			}
+		case RelabelDrop:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %s", i, rule.Action)
+		}
+		relabelers[i] = relabeler{rule: rule, re: re}
+	}
+	return relabelers, nil
+}
+
+func relabel(relabelers []relabeler, tags stats.Tags) stats.Tags {
+	for _, r := range relabelers {
+		switch r.rule.Action {
+		case "", RelabelReplace:
+			values := make([]string, len(r.rule.Source))
+			for i, k := range r.rule.Source {
+				values[i] = tags[k]
+			}
+			value := strings.Join(values, ";")
+			match := r.re.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			if result := string(r.re.ExpandString(nil, r.rule.Replacement, value, match)); result != "" {
+				tags[r.rule.Target] = result
+			} else {
+				delete(tags, r.rule.Target)
+			}
+		case RelabelRename:
+			if v, ok := tags[r.rule.Source[0]]; ok {
+				delete(tags, r.rule.Source[0])
+				tags[r.rule.Target] = v
+			}
+		case RelabelDrop:
+			for _, k := range r.rule.Source {
+				if v, ok := tags[k]; ok && r.re.MatchString(v) {
+					delete(tags, k)
+				}
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,76 @@
+package statsutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+)
+
+func TestRelabel(t *testing.T) {
+	for _, testcase := range []struct {
+		rule     RelabelRule
+		tags     stats.Tags
+		expected stats.Tags
+	}{
+		{
+			rule:     RelabelRule{Source: []string{"dc", "role"}, Target: "group", Replacement: "$1-$2", Regex: "(.*);(.*)"},
+			tags:     stats.Tags{"dc": "sg", "role": "web"},
+			expected: stats.Tags{"dc": "sg", "role": "web", "group": "sg-web"},
+		},
+		{
+			rule:     RelabelRule{Source: []string{"version"}, Target: "major", Replacement: "v${major}", Regex: `(?P<major>\d+)\..*`},
+			tags:     stats.Tags{"version": "1.2.3"},
+			expected: stats.Tags{"version": "1.2.3", "major": "v1"},
+		},
+		{
+			rule:     RelabelRule{Source: []string{"version"}, Target: "major", Replacement: "$1", Regex: `(\d+)\..*`},
+			tags:     stats.Tags{"version": "dev"},
+			expected: stats.Tags{"version": "dev"},
+		},
+		{
+			rule:     RelabelRule{Action: RelabelRename, Source: []string{"host"}, Target: "instance"},
+			tags:     stats.Tags{"host": "a"},
+			expected: stats.Tags{"instance": "a"},
+		},
+		{
+			rule:     RelabelRule{Action: RelabelDrop, Source: []string{"pid", "host"}, Regex: `\d+`},
+			tags:     stats.Tags{"pid": "123", "host": "a"},
+			expected: stats.Tags{"host": "a"},
+		},
+	} {
+		relabelers, err := compileRelabel([]RelabelRule{testcase.rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := relabel(relabelers, testcase.tags); !reflect.DeepEqual(actual, testcase.expected) {
+			t.Fatalf("%+v: expect %v got %v", testcase.rule, testcase.expected, actual)
+		}
+	}
+}
+
+func TestCollectStatsTags(t *testing.T) {
+	source := stats.New()
+	source.Meter("test", stats.Tags{"pid": "1"}).Inc(time.Now(), 1)
+	server := httptest.NewServer(NewHandler(source, "/", Options{Tags: stats.Tags{"version": "1.2", "dc": "x"}}))
+	defer server.Close()
+
+	hosts := []Host{{
+		Tag:          "a",
+		URLs:         []string{server.URL + "/vars"},
+		Tags:         stats.Tags{"dc": "sg"},
+		DiscoverTags: true,
+		Relabel:      []RelabelRule{{Action: RelabelDrop, Source: []string{"pid"}}},
+	}}
+	s, err := CollectStats(http.DefaultClient, hosts, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := stats.NewKey("test", stats.Tags{"host": "a", "dc": "sg", "version": "1.2"})
+	if _, ok := s.Meters[key]; !ok {
+		t.Fatalf("expect %s in %v", key, s)
+	}
+}
@@ -0,0 +1,106 @@
+package statsutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"h12.io/stats"
+)
+
+// ringHandler serves the binary form of the ring given by ?name=
+func ringHandler(opt *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ring, ok := opt.Rings[req.URL.Query().Get("name")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", binaryContentType)
+		bw := bufio.NewWriter(w)
+		if _, err := ring.WriteTo(bw); err != nil {
+			return
+		}
+		bw.Flush()
+	})
+}
+
+// ringMergeHandler fetches a ring from the ring route of another host given
+// by ?from= and merges it into the local ring given by ?name=
+func ringMergeHandler(opt *Options) http.Handler {
+	client := opt.pullClient()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ring, ok := opt.Rings[req.URL.Query().Get("name")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		from, err := url.Parse(req.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !opt.pullAllowed(from) {
+			http.Error(w, "pulling from "+from.String()+" is not allowed", http.StatusForbidden)
+			return
+		}
+		other, err := fetchRing(client, from.String(), ring.Empty(), opt.MaxBodySize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if err := ring.Merge(other); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+// ringDiagnosticsHandler serves the diagnostics of the ring given by ?name=
+// or of every ring by name in JSON
+func ringDiagnosticsHandler(opt *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var v interface{}
+		if name := req.URL.Query().Get("name"); name != "" {
+			ring, ok := opt.Rings[name]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			v = ring.Diagnostics(opt.FillWarning)
+		} else {
+			m := make(map[string]stats.RingDiagnostics, len(opt.Rings))
+			for name, ring := range opt.Rings {
+				m[name] = ring.Diagnostics(opt.FillWarning)
+			}
+			v = m
+		}
+		buf, err := marshalJSON(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(buf)
+	})
+}
+
+func fetchRing(client *http.Client, uri string, ring *stats.RingSketcher, maxSize int64) (*stats.RingSketcher, error) {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d: %s", resp.StatusCode, uri)
+	}
+	body := &io.LimitedReader{R: resp.Body, N: maxSize + 1}
+	if _, err := ring.ReadFrom(bufio.NewReader(body)); err != nil {
+		return nil, err
+	}
+	if body.N <= 0 {
+		return nil, fmt.Errorf("response body too large: %s", uri)
+	}
+	return ring, nil
+}
@@ -0,0 +1,76 @@
+package statsutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"h12.io/stats"
+)
+
+func TestRingMerge(t *testing.T) {
+	key := []byte("a")
+	remote := stats.NewSyncRingSketcher(stats.NewMapRingSketcher(4, 1000, 0))
+	remote.Inc(1, key)
+	remote.Inc(1, key)
+	remoteServer := httptest.NewServer(NewHandler(stats.New(), "/", Options{
+		Rings: map[string]*stats.SyncRingSketcher{"users": remote},
+	}))
+	defer remoteServer.Close()
+
+	local := stats.NewSyncRingSketcher(stats.NewMapRingSketcher(4, 1000, 0))
+	local.Inc(1, key)
+	remoteURL, _ := url.Parse(remoteServer.URL)
+	server := httptest.NewServer(NewHandler(stats.New(), "/", Options{
+		PullAllow: []string{remoteURL.Hostname()},
+		Rings:     map[string]*stats.SyncRingSketcher{"users": local},
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ring/merge?name=users&from=" + url.QueryEscape(remoteServer.URL+"/ring?name=users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect %d got %d", http.StatusOK, resp.StatusCode)
+	}
+	if v := local.Get(1, key); v != 3 {
+		t.Fatalf("expect 3 got %v", v)
+	}
+}
+
+func TestRingDiagnostics(t *testing.T) {
+	ring := stats.NewSyncRingSketcher(stats.NewMapRingSketcher(2, 4, 0))
+	ring.Inc(0, []byte("a"))
+	ring.Inc(0, []byte("b"))
+	ring.Inc(0, []byte("c"))
+	server := httptest.NewServer(NewHandler(stats.New(), "/", Options{
+		Rings: map[string]*stats.SyncRingSketcher{"users": ring},
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ring/diagnostics?name=users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var d stats.RingDiagnostics
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.MaxFillRatio != 0.75 || !d.Overloaded || len(d.Slots) != 2 {
+		t.Fatalf("%+v", d)
+	}
+
+	resp, err = http.Get(server.URL + "/ring/diagnostics?name=unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect %d got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
@@ -3,46 +3,182 @@ package statsutil
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
 	"time"
 
 	"h12.io/stats"
 )
 
+const (
+	binaryContentType = "application/octet-stream"
+
+	DefaultMaxBodySize = 32 << 20
+	DefaultOriginTag   = "origin"
+)
+
+// Options configures the routes served by NewHandler
+type Options struct {
+	// PullAllow lists the sources the pull route may fetch from. A pattern
+	// containing "://" allows URLs with its scheme and host and a path
+	// within its path, otherwise it is matched against the host with
+	// path.Match. URLs with user info and pulling with an empty list are
+	// refused.
+	PullAllow []string
+
+	// BearerToken, or Username and Password, require every request to
+	// authenticate with the bearer or basic scheme when set
+	BearerToken string
+	Username    string
+	Password    string
+
+	// MaxBodySize limits the size of a pulled or pushed body,
+	// DefaultMaxBodySize is used when it is 0
+	MaxBodySize int64
+
+	// OriginTag is the tag that records where merged data came from,
+	// DefaultOriginTag is used when it is empty
+	OriginTag string
+
+	// Tags are returned by the vars route in TagsHeader for collectors to
+	// discover
+	Tags stats.Tags
+
+	// Rings are served by the ring route and merged by the ring/merge route
+	// by their names
+	Rings map[string]*stats.SyncRingSketcher
+
+	// FillWarning is the fill ratio above which the ring/diagnostics route
+	// reports a ring as overloaded, stats.DefaultFillWarning is used when it
+	// is 0
+	FillWarning float64
+
+	pullURLs  []*url.URL // URL patterns of PullAllow, parsed by NewHandler
+	pullHosts []string   // host patterns of PullAllow
+}
+
+// Handler serves the routes of NewHandler with default options
 func Handler(s *stats.S, root string) http.Handler {
+	return NewHandler(s, root, Options{})
+}
+
+func NewHandler(s *stats.S, root string, opt Options) http.Handler {
+	if opt.MaxBodySize == 0 {
+		opt.MaxBodySize = DefaultMaxBodySize
+	}
+	if opt.OriginTag == "" {
+		opt.OriginTag = DefaultOriginTag
+	}
+	if opt.FillWarning == 0 {
+		opt.FillWarning = stats.DefaultFillWarning
+	}
+	opt.parsePullAllow()
 	mux := http.NewServeMux()
-	mux.Handle(path.Join(root, "vars"), varsHandler(s))
-	mux.Handle(path.Join(root, "pull"), pullHandler(s))
-	return mux
+	mux.Handle(path.Join(root, "vars"), varsHandler(s, &opt))
+	mux.Handle(path.Join(root, "pull"), pullHandler(s, &opt))
+	mux.Handle(path.Join(root, "push"), pushHandler(s, &opt))
+	mux.Handle(path.Join(root, "ring"), ringHandler(&opt))
+	mux.Handle(path.Join(root, "ring", "merge"), ringMergeHandler(&opt))
+	mux.Handle(path.Join(root, "ring", "diagnostics"), ringDiagnosticsHandler(&opt))
+	dashboard := path.Join(root, "dashboard") + "/"
+	mux.Handle(dashboard, dashboardHandler(dashboard))
+	return authHandler(mux, &opt)
 }
 
-func pullHandler(s *stats.S) http.Handler {
-	client := http.Client{} // shared client
+func pullHandler(s *stats.S, opt *Options) http.Handler {
+	client := opt.pullClient() // shared client
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		from := req.URL.Query().Get("from")
-		resp, err := client.Get(from)
+		from, err := url.Parse(req.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !opt.pullAllowed(from) {
+			http.Error(w, "pulling from "+from.String()+" is not allowed", http.StatusForbidden)
+			return
+		}
+		resp, err := client.Get(from.String())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			http.Error(w, resp.Status, http.StatusBadGateway)
+			return
+		}
 		otherStats := stats.New()
-		if err := json.NewDecoder(resp.Body).Decode(otherStats); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		body := &io.LimitedReader{R: resp.Body, N: opt.MaxBodySize + 1}
+		if err := decodeStats(resp.Header.Get("Content-Type"), body, otherStats); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if body.N <= 0 {
+			http.Error(w, "response body too large", http.StatusBadGateway)
+			return
+		}
+		start := time.Now().Add(-time.Duration(stats.DefaultBufferSize) * time.Second)
+		if err := s.MergeWithTags(otherStats, start, stats.Tags{opt.OriginTag: from.Host}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
 		}
-		s.Merge(otherStats, time.Now().Add(-time.Duration(stats.DefaultBufferSize)*time.Second))
 	})
 }
 
-func varsHandler(s *stats.S) http.Handler {
+// pushHandler merges a snapshot POSTed by a Pusher, every query parameter of
+// the request is added as a tag to the merged meters
+func pushHandler(s *stats.S, opt *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		otherStats := stats.New()
+		body := http.MaxBytesReader(w, req.Body, opt.MaxBodySize)
+		if err := decodeStats(req.Header.Get("Content-Type"), body, otherStats); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tags := make(stats.Tags)
+		for key := range req.URL.Query() {
+			tags[key] = req.URL.Query().Get(key)
+		}
+		tags[opt.OriginTag] = remoteHost(req)
+		start := time.Now().Add(-time.Duration(stats.DefaultBufferSize) * time.Second)
+		if err := s.MergeWithTags(otherStats, start, tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func decodeStats(contentType string, r io.Reader, s *stats.S) error {
+	if contentType == binaryContentType {
+		_, err := s.ReadFrom(r)
+		return err
+	}
+	return json.NewDecoder(r).Decode(s)
+}
+
+func varsHandler(s *stats.S, opt *Options) http.Handler {
+	tags := make(url.Values)
+	for k, v := range opt.Tags {
+		tags.Set(k, v)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		buf, err := marshalJSON(s)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if len(tags) > 0 {
+			w.Header().Set(TagsHeader, tags.Encode())
+		}
+		w.Header().Set(TimeHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
 		w.Write(buf)
 	})
 }
@@ -0,0 +1,121 @@
+package statsutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"h12.io/stats"
+)
+
+func TestPullAllow(t *testing.T) {
+	source := stats.New()
+	source.Meter("test", nil).Inc(time.Now(), 1)
+	sourceServer := httptest.NewServer(Handler(source, "/"))
+	defer sourceServer.Close()
+	sourceURL, _ := url.Parse(sourceServer.URL)
+
+	for _, testcase := range []struct {
+		allow  []string
+		status int
+	}{
+		{allow: nil, status: http.StatusForbidden},
+		{allow: []string{"example.com"}, status: http.StatusForbidden},
+		{allow: []string{sourceURL.Hostname()}, status: http.StatusOK},
+		{allow: []string{sourceServer.URL + "/vars"}, status: http.StatusOK},
+	} {
+		s := stats.New()
+		server := httptest.NewServer(NewHandler(s, "/", Options{PullAllow: testcase.allow}))
+		resp, err := http.Get(server.URL + "/pull?from=" + url.QueryEscape(sourceServer.URL+"/vars"))
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != testcase.status {
+			t.Fatalf("%v: expect %d got %d", testcase.allow, testcase.status, resp.StatusCode)
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		key := stats.NewKey("test", stats.Tags{DefaultOriginTag: sourceURL.Host})
+		if _, ok := s.Meters[key]; !ok {
+			t.Fatalf("expect %s in %v", key, s)
+		}
+	}
+}
+
+func TestPullAllowedURL(t *testing.T) {
+	opt := Options{PullAllow: []string{"http://example.com/stats", "https://example.org", "*.example.net"}}
+	opt.parsePullAllow()
+	for _, testcase := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/stats", true},
+		{"http://example.com/stats/vars", true},
+		{"http://example.com/statsx", false},
+		{"http://example.com/stats/../admin", false},
+		{"http://example.com/stats/%2e%2e/admin", false},
+		{"http://example.com.evil.net/stats", false},
+		{"http://example.com:1@evil.net/stats", false},
+		{"http://user@example.com/stats", false},
+		{"https://example.com/stats", false},
+		{"https://example.org/vars", true},
+		{"https://example.org.evil.net/vars", false},
+		{"http://a.example.net/vars", true},
+		{"http://a@a.example.net/vars", false},
+		{"ftp://a.example.net/vars", false},
+	} {
+		u, err := url.Parse(testcase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := opt.pullAllowed(u); allowed != testcase.allowed {
+			t.Fatalf("%s: expect %v got %v", testcase.url, testcase.allowed, allowed)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	server := httptest.NewServer(NewHandler(stats.New(), "/", Options{BearerToken: "secret"}))
+	defer server.Close()
+	for _, testcase := range []struct {
+		auth   string
+		status int
+	}{
+		{auth: "", status: http.StatusUnauthorized},
+		{auth: "Bearer wrong", status: http.StatusUnauthorized},
+		{auth: "Bearer secret", status: http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/vars", nil)
+		if testcase.auth != "" {
+			req.Header.Set("Authorization", testcase.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != testcase.status {
+			t.Fatalf("%q: expect %d got %d", testcase.auth, testcase.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	server := httptest.NewServer(Handler(stats.New(), "/"))
+	defer server.Close()
+	for _, file := range []string{"", "dashboard.js", "dashboard.css"} {
+		resp, err := http.Get(server.URL + "/dashboard/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expect %d got %d", file, http.StatusOK, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package stats
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncRingSketcher is a RingSketcher safe for concurrent use. Each slot has
+// its own lock so that updates and queries of different offsets do not
+// block each other, the whole ring is only locked when it rotates.
+type SyncRingSketcher struct {
+	ring  *RingSketcher
+	locks []sync.RWMutex // one per slot of ring.a
+	mu    sync.RWMutex   // guards the rotation of ring
+}
+
+func NewSyncRingSketcher(ring *RingSketcher) *SyncRingSketcher {
+	return &SyncRingSketcher{
+		ring:  ring,
+		locks: make([]sync.RWMutex, len(ring.a)),
+	}
+}
+
+func (s *SyncRingSketcher) Offset() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Offset()
+}
+
+func (s *SyncRingSketcher) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.locks)
+}
+
+func (s *SyncRingSketcher) Inc(offset int64, key []byte) {
+	s.update(offset, func(sk Sketcher) { sk.Inc(key) })
+}
+
+func (s *SyncRingSketcher) Add(offset int64, key []byte, n uint64) {
+	s.update(offset, func(sk Sketcher) { sk.Add(key, n) })
+}
+
+func (s *SyncRingSketcher) update(offset int64, f func(Sketcher)) {
+	s.mu.RLock()
+	pos := s.ring.pos(offset)
+	if pos >= 0 {
+		s.locks[pos].Lock()
+		f(s.ring.a[pos])
+		s.locks[pos].Unlock()
+		s.mu.RUnlock()
+		return
+	}
+	old := offset < s.ring.offset
+	s.mu.RUnlock()
+	if old {
+		return
+	}
+
+	// the ring needs to rotate
+	s.mu.Lock()
+	if pos := s.ring.rotate(offset, s.ring.reset); pos >= 0 {
+		f(s.ring.a[pos])
+	}
+	s.mu.Unlock()
+}
+
+func (s *SyncRingSketcher) Get(offset int64, key []byte) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pos := s.ring.pos(offset)
+	if pos < 0 {
+		return 0
+	}
+	s.locks[pos].RLock()
+	v := s.ring.a[pos].Get(key)
+	s.locks[pos].RUnlock()
+	return v
+}
+
+// Sum returns the sum of the counts of key over the offsets within [from, to]
+func (s *SyncRingSketcher) Sum(from, to int64, key []byte) float64 {
+	s.mu.RLock()
+	from, to = s.ring.clip(from, to)
+	s.mu.RUnlock()
+	sum := 0.0
+	for offset := from; offset <= to; offset++ {
+		sum += s.Get(offset, key)
+	}
+	return sum
+}
+
+// Max returns the maximum count of key over the offsets within [from, to]
+func (s *SyncRingSketcher) Max(from, to int64, key []byte) float64 {
+	s.mu.RLock()
+	from, to = s.ring.clip(from, to)
+	s.mu.RUnlock()
+	max := 0.0
+	for offset := from; offset <= to; offset++ {
+		if v := s.Get(offset, key); v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Last returns the sum of the counts of key over the last n offsets of the
+// ring
+func (s *SyncRingSketcher) Last(n int, key []byte) float64 {
+	s.mu.RLock()
+	end := s.ring.offset + int64(s.ring.size) - 1
+	s.mu.RUnlock()
+	return s.Sum(end-int64(n)+1, end, key)
+}
+
+// Merge adds the sketchers of o into s at the same offsets
+func (s *SyncRingSketcher) Merge(o *RingSketcher) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ring.Merge(o)
+}
+
+// CheckMerge returns an error if o cannot be merged into s
+func (s *SyncRingSketcher) CheckMerge(o *RingSketcher) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.CheckMerge(o)
+}
+
+// Diagnostics returns the Diagnostics of the ring, each slot is read under
+// its own lock so that updates of the other slots are not blocked
+func (s *SyncRingSketcher) Diagnostics(fillWarning float64) RingDiagnostics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.diagnostics(fillWarning, func(pos int, sd Diagnoser) Diagnostics {
+		s.locks[pos].RLock()
+		defer s.locks[pos].RUnlock()
+		return sd.Diagnostics()
+	})
+}
+
+// Empty returns an empty RingSketcher to be filled by ReadFrom and merged
+// into s
+func (s *SyncRingSketcher) Empty() *RingSketcher {
+	return s.ring.Empty()
+}
+
+func (s *SyncRingSketcher) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ring.WriteTo(w)
+}
+
+func (s *SyncRingSketcher) WriteFrame(w io.Writer, flags FrameFlags) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ring.WriteFrame(w, flags)
+}
+
+func (s *SyncRingSketcher) ReadFrom(r io.Reader) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.ring.ReadFrom(r)
+	if len(s.locks) != len(s.ring.a) {
+		s.locks = make([]sync.RWMutex, len(s.ring.a))
+	}
+	return n, err
+}
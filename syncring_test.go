@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSyncRingSketcher(t *testing.T) {
+	for _, newRing := range []func() *RingSketcher{
+		func() *RingSketcher { return NewCMLRingSketcher(4, 1000000, 0) },
+		func() *RingSketcher { return NewMapRingSketcher(4, 1000000, 0) },
+	} {
+		s := NewSyncRingSketcher(newRing())
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				key := []byte(strconv.Itoa(g))
+				for offset := int64(0); offset < 8; offset++ {
+					for i := 0; i < 10; i++ {
+						s.Inc(offset, key)
+						s.Get(offset, key)
+					}
+					s.Sum(0, offset, key)
+					s.Diagnostics(DefaultFillWarning)
+				}
+			}(g)
+		}
+		wg.Wait()
+		if s.Offset() != 4 {
+			t.Fatalf("expect offset 4 got %d", s.Offset())
+		}
+		for g := 0; g < 8; g++ {
+			// CML may miss an increment occasionally
+			if cnt := int(s.Get(7, []byte(strconv.Itoa(g))) + 0.5); cnt < 9 || cnt > 10 {
+				t.Fatalf("expect 10 got %d", cnt)
+			}
+		}
+	}
+}
+
+func BenchmarkSyncRingSketcherInc(b *testing.B) {
+	s := NewSyncRingSketcher(NewCMLRingSketcher(60, 1000000, 0))
+	benchmarkParallel(b, s.Inc)
+}
+
+func BenchmarkSyncRingSketcherIncGet(b *testing.B) {
+	s := NewSyncRingSketcher(NewCMLRingSketcher(60, 1000000, 0))
+	benchmarkParallel(b, func(offset int64, key []byte) {
+		s.Inc(offset, key)
+		s.Get(offset-1, key)
+	})
+}
+
+// BenchmarkMutexRingSketcherInc locks the whole ring for comparison
+func BenchmarkMutexRingSketcherInc(b *testing.B) {
+	s := NewCMLRingSketcher(60, 1000000, 0)
+	var mu sync.Mutex
+	benchmarkParallel(b, func(offset int64, key []byte) {
+		mu.Lock()
+		s.Inc(offset, key)
+		mu.Unlock()
+	})
+}
+
+func benchmarkParallel(b *testing.B, f func(offset int64, key []byte)) {
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			// spread the updates over the last few offsets
+			f(int64(60+i%4), keys[i%len(keys)])
+			i++
+		}
+	})
+}
@@ -0,0 +1,330 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"h12.io/stats/binary"
+)
+
+type (
+	// TDigest is a merging t-digest that estimates the quantiles of a stream
+	// of float values. It keeps O(compression) centroids, a larger compression
+	// gives more accurate quantiles, especially near the tails.
+	TDigest struct {
+		compression float64
+		centroids   []centroid // sorted by mean
+		buf         []centroid // values not merged into centroids yet
+		count       float64
+		min         float64
+		max         float64
+	}
+	centroid struct {
+		mean   float64
+		weight float64
+	}
+)
+
+const DefaultCompression = 100
+
+func NewTDigest(compression float64) *TDigest {
+	if compression < 10 {
+		panic("compression should be at least 10")
+	}
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (t *TDigest) Add(v float64) {
+	t.AddWeighted(v, 1)
+}
+
+func (t *TDigest) AddWeighted(v, weight float64) {
+	if math.IsNaN(v) || weight <= 0 {
+		return
+	}
+	t.buf = append(t.buf, centroid{mean: v, weight: weight})
+	t.count += weight
+	if v < t.min {
+		t.min = v
+	}
+	if v > t.max {
+		t.max = v
+	}
+	if len(t.buf) >= int(5*t.compression) {
+		t.compress()
+	}
+}
+
+// Count returns the total weight of the values added
+func (t *TDigest) Count() float64 {
+	return t.count
+}
+
+// Quantile returns the estimated value at quantile q within [0, 1], or NaN
+// if the digest is empty
+func (t *TDigest) Quantile(q float64) float64 {
+	t.compress()
+	if len(t.centroids) == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+	target := q * t.count
+	// interpolate between the centers of adjacent centroids, with min and
+	// max as the outer ends
+	prevCenter, prevMean := 0.0, t.min
+	cum := 0.0
+	for _, c := range t.centroids {
+		center := cum + c.weight/2
+		if target < center {
+			return interpolate(target, prevCenter, center, prevMean, c.mean)
+		}
+		prevCenter, prevMean = center, c.mean
+		cum += c.weight
+	}
+	return interpolate(target, prevCenter, t.count, prevMean, t.max)
+}
+
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 <= x0 {
+		return y1
+	}
+	return y0 + (x-x0)/(x1-x0)*(y1-y0)
+}
+
+// Merge adds all the values of o into t
+func (t *TDigest) Merge(o *TDigest) error {
+	if err := t.checkMerge(o); err != nil {
+		return err
+	}
+	if o.count == 0 {
+		return nil
+	}
+	t.buf = append(t.buf, o.centroids...)
+	t.buf = append(t.buf, o.buf...)
+	t.count += o.count
+	t.min = math.Min(t.min, o.min)
+	t.max = math.Max(t.max, o.max)
+	t.compress()
+	return nil
+}
+
+// checkMerge returns the error of Merge for o without merging it, TDigests
+// of any compression merge so it only fails for a missing digest
+func (t *TDigest) checkMerge(o *TDigest) error {
+	if o == nil {
+		return errors.New("cannot merge a nil TDigest")
+	}
+	return nil
+}
+
+func (t *TDigest) Reset() {
+	t.centroids = t.centroids[:0]
+	t.buf = t.buf[:0]
+	t.count = 0
+	t.min = math.Inf(1)
+	t.max = math.Inf(-1)
+}
+
+func (t *TDigest) clone() *TDigest {
+	t.compress()
+	c := *t
+	c.centroids = append([]centroid(nil), t.centroids...)
+	c.buf = nil
+	return &c
+}
+
+// compress merges buffered values into the centroids so that every centroid
+// spans at most 1 in the k1 scale function
+func (t *TDigest) compress() {
+	if len(t.buf) == 0 {
+		return
+	}
+	all := append(t.buf, t.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	weightSoFar := 0.0
+	qLimit := t.kInv(t.k(0) + 1)
+	for _, c := range all[1:] {
+		if (weightSoFar+cur.weight+c.weight)/t.count <= qLimit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		weightSoFar += cur.weight
+		qLimit = t.kInv(t.k(weightSoFar/t.count) + 1)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.buf = t.buf[:0]
+}
+
+func (t *TDigest) k(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (t *TDigest) kInv(k float64) float64 {
+	if k >= t.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.compression) + 1) / 2
+}
+
+func (t *TDigest) WriteTo(w io.Writer) (int64, error) {
+	t.compress()
+	enc := binary.NewEncoder(w)
+	enc.WriteFloat64(t.compression)
+	enc.WriteFloat64(t.count)
+	enc.WriteFloat64(t.min)
+	enc.WriteFloat64(t.max)
+	enc.WriteInt64(int64(len(t.centroids)))
+	for _, c := range t.centroids {
+		enc.WriteFloat64(c.mean)
+		enc.WriteFloat64(c.weight)
+	}
+	return enc.Flush()
+}
+
+func (t *TDigest) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	t.compression = dec.ReadFloat64()
+	t.count = dec.ReadFloat64()
+	t.min = dec.ReadFloat64()
+	t.max = dec.ReadFloat64()
+	if dec.Err() == nil && !(t.compression >= 10) {
+		dec.Fail(fmt.Errorf("%w: invalid t-digest compression", binary.ErrCorrupt))
+	}
+	size := dec.ReadInt64()
+	if dec.Err() == nil {
+		dec.Fail(binary.CheckLen(size, binary.MaxSliceLen))
+	}
+	t.buf = nil
+	t.centroids = nil
+	for i := int64(0); i < size && dec.Err() == nil; i++ {
+		c := centroid{mean: dec.ReadFloat64(), weight: dec.ReadFloat64()}
+		if dec.Err() == nil {
+			t.centroids = append(t.centroids, c)
+		}
+	}
+	return dec.Result()
+}
+
+// RingTDigest is a ring of TDigests parallel to RingSketcher, it estimates
+// the quantiles of the values per offset and over sliding windows
+type RingTDigest struct {
+	ringIndex
+	a []*TDigest
+}
+
+func NewRingTDigest(ringSize int, compression float64, startOffset int64) *RingTDigest {
+	if ringSize < 1 {
+		panic("must have at least 1 TDigest")
+	}
+	a := make([]*TDigest, ringSize)
+	for i := range a {
+		a[i] = NewTDigest(compression)
+	}
+	return &RingTDigest{
+		ringIndex: ringIndex{offset: startOffset, size: ringSize},
+		a:         a,
+	}
+}
+
+func (m *RingTDigest) Offset() int64 {
+	return m.offset
+}
+
+func (m *RingTDigest) Add(offset int64, v float64) {
+	pos := m.rotate(offset, m.reset)
+	if pos < 0 {
+		return
+	}
+	m.a[pos].Add(v)
+}
+
+// Quantile returns the value at quantile q of the values over the offsets
+// within [from, to], or NaN if there is none
+func (m *RingTDigest) Quantile(from, to int64, q float64) float64 {
+	from, to = m.clip(from, to)
+	var union *TDigest
+	for offset := from; offset <= to; offset++ {
+		pos := m.pos(offset)
+		if pos < 0 {
+			continue
+		}
+		if union == nil {
+			union = m.a[pos].clone()
+		} else if err := union.Merge(m.a[pos]); err != nil {
+			return math.NaN()
+		}
+	}
+	if union == nil {
+		return math.NaN()
+	}
+	return union.Quantile(q)
+}
+
+// Merge adds the values of every offset of o to the same offset of m, m
+// rotates forward if o has newer offsets. m is left unchanged if a TDigest of
+// o cannot be merged.
+func (m *RingTDigest) Merge(o *RingTDigest) error {
+	if len(m.a) > 0 {
+		for _, t := range o.a {
+			if err := m.a[0].checkMerge(t); err != nil {
+				return err
+			}
+		}
+	}
+	for offset := o.offset; offset < o.offset+int64(o.size); offset++ {
+		pos := m.rotate(offset, m.reset)
+		if pos < 0 {
+			continue
+		}
+		if err := m.a[pos].Merge(o.a[o.pos(offset)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RingTDigest) reset(pos int) {
+	m.a[pos].Reset()
+}
+
+func (m *RingTDigest) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.Encode(&m.ringIndex)
+	for i := range m.a {
+		enc.Encode(m.a[i])
+	}
+	return enc.Flush()
+}
+
+func (m *RingTDigest) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	var index ringIndex
+	dec.Decode(&index)
+	a := make([]*TDigest, 0, initialSlots(index.size))
+	for i := 0; i < index.size && dec.Err() == nil; i++ {
+		v := &TDigest{}
+		dec.Decode(v)
+		a = append(a, v)
+	}
+	if dec.Err() == nil {
+		m.ringIndex, m.a = index, a
+	}
+	return dec.Result()
+}
@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTDigest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 100000)
+	t1, t2 := NewTDigest(DefaultCompression), NewTDigest(DefaultCompression)
+	for i := range values {
+		values[i] = rnd.ExpFloat64() * 100
+		if i%2 == 0 {
+			t1.Add(values[i])
+		} else {
+			t2.Add(values[i])
+		}
+	}
+	if err := t1.Merge(t2); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := t1.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var td TDigest
+	if _, err := td.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(td.centroids) > 5*DefaultCompression {
+		t.Fatalf("too many centroids %d", len(td.centroids))
+	}
+
+	sort.Float64s(values)
+	for _, q := range []float64{0, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+		expected := values[int(math.Min(q*float64(len(values)), float64(len(values)-1)))]
+		// compare by rank so that the error is relative to the quantile
+		actualRank := float64(sort.SearchFloat64s(values, td.Quantile(q))) / float64(len(values))
+		if math.Abs(actualRank-q) > 0.01 {
+			t.Fatalf("quantile %v: expect %v got %v (rank %v)", q, expected, td.Quantile(q), actualRank)
+		}
+	}
+}
+
+func TestRingTDigest(t *testing.T) {
+	s := NewRingTDigest(3, DefaultCompression, 0)
+	for offset := int64(0); offset < 4; offset++ {
+		for i := 0; i < 100; i++ {
+			s.Add(offset, float64(offset*100+int64(i)))
+		}
+	}
+	if v := s.Quantile(0, 0, 0.5); !math.IsNaN(v) {
+		t.Fatalf("offset 0 should have been rotated out, got %v", v)
+	}
+	if v := s.Quantile(math.MinInt64, math.MaxInt64, 0.5); math.Abs(v-250) > 3 {
+		t.Fatalf("expect 250 over the whole ring, got %v", v)
+	}
+	if v := s.Quantile(1, 3, 0.5); math.Abs(v-250) > 3 {
+		t.Fatalf("expect median about 250 got %v", v)
+	}
+
+	other := NewRingTDigest(3, DefaultCompression, 1)
+	for i := 0; i < 100; i++ {
+		other.Add(3, 1000)
+	}
+	if err := s.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Quantile(3, 3, 0.75); v != 1000 {
+		t.Fatalf("expect 1000 got %v", v)
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var s2 RingTDigest
+	if _, err := s2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, expected := s2.Quantile(1, 3, 0.5), s.Quantile(1, 3, 0.5); v != expected {
+		t.Fatalf("expect %v got %v", expected, v)
+	}
+}
+
+func TestRingTDigestMergeFailure(t *testing.T) {
+	s := NewRingTDigest(2, 100, 0)
+	s.Add(1, 5)
+	o := NewRingTDigest(2, 100, 4)
+	o.Add(5, 1)
+	o.a[o.pos(4)] = nil
+	if err := s.Merge(o); err == nil {
+		t.Fatal("expect error merging a nil TDigest")
+	}
+	if s.Offset() != 0 || s.Quantile(1, 1, 0.5) != 5 {
+		t.Fatalf("expect the ring unchanged, offset %d", s.Offset())
+	}
+}
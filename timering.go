@@ -0,0 +1,63 @@
+package stats
+
+import "time"
+
+// TimeRingSketcher maps wall-clock time to the offsets of a RingSketcher,
+// offset i covers the time within [i*Slot, (i+1)*Slot) since the Unix epoch
+type TimeRingSketcher struct {
+	Ring *RingSketcher
+	Slot time.Duration
+}
+
+func NewTimeRingSketcher(ring *RingSketcher, slot time.Duration) *TimeRingSketcher {
+	if slot <= 0 {
+		panic("slot must be positive")
+	}
+	return &TimeRingSketcher{
+		Ring: ring,
+		Slot: slot,
+	}
+}
+
+// Offset returns the offset of the slot that covers t
+func (s *TimeRingSketcher) Offset(t time.Time) int64 {
+	ns := t.UnixNano()
+	offset := ns / int64(s.Slot)
+	if ns < 0 && ns%int64(s.Slot) != 0 {
+		offset--
+	}
+	return offset
+}
+
+// Time returns the start time of the slot at offset
+func (s *TimeRingSketcher) Time(offset int64) time.Time {
+	return time.Unix(0, offset*int64(s.Slot))
+}
+
+func (s *TimeRingSketcher) Inc(t time.Time, key []byte) {
+	s.Ring.Inc(s.Offset(t), key)
+}
+
+func (s *TimeRingSketcher) Add(t time.Time, key []byte, n uint64) {
+	s.Ring.Add(s.Offset(t), key, n)
+}
+
+func (s *TimeRingSketcher) Get(t time.Time, key []byte) float64 {
+	return s.Ring.Get(s.Offset(t), key)
+}
+
+// Sum returns the sum of the counts of key in the slots covering [from, to]
+func (s *TimeRingSketcher) Sum(from, to time.Time, key []byte) float64 {
+	return s.Ring.Sum(s.Offset(from), s.Offset(to), key)
+}
+
+// Max returns the maximum count of key in the slots covering [from, to]
+func (s *TimeRingSketcher) Max(from, to time.Time, key []byte) float64 {
+	return s.Ring.Max(s.Offset(from), s.Offset(to), key)
+}
+
+// Last returns the sum of the counts of key in the slots covering the
+// duration d until now
+func (s *TimeRingSketcher) Last(now time.Time, d time.Duration, key []byte) float64 {
+	return s.Ring.Sum(s.Offset(now.Add(-d+1)), s.Offset(now), key)
+}
@@ -0,0 +1,61 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRingSketcherWindow(t *testing.T) {
+	s := NewMapRingSketcher(4, 1000, 0)
+	key := []byte("a")
+	for offset := int64(0); offset < 6; offset++ {
+		for i := int64(0); i <= offset; i++ {
+			s.Inc(offset, key)
+		}
+	}
+	// ring covers offsets 2..5 with counts 3, 4, 5, 6
+	for i, testcase := range []struct {
+		actual, expected float64
+	}{
+		{s.Sum(0, 10, key), 18},
+		{s.Sum(3, 4, key), 9},
+		{s.Max(0, 3, key), 4},
+		{s.Max(0, 10, key), 6},
+		{s.Last(2, key), 11},
+		{s.Last(10, key), 18},
+	} {
+		if testcase.actual != testcase.expected {
+			t.Fatalf("%d: expect %v got %v", i, testcase.expected, testcase.actual)
+		}
+	}
+}
+
+func TestTimeRingSketcher(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewTimeRingSketcher(NewMapRingSketcher(6, 1000, 0), 10*time.Second)
+	key := []byte("a")
+	s.Inc(now, key)
+	s.Inc(now.Add(9*time.Second), key)
+	s.Inc(now.Add(10*time.Second), key)
+	s.Inc(now.Add(25*time.Second), key)
+
+	if offset := s.Offset(now.Add(19 * time.Second)); offset != 101 {
+		t.Fatalf("expect offset 101 got %d", offset)
+	}
+	if !s.Time(101).Equal(now.Add(10 * time.Second)) {
+		t.Fatalf("expect %v got %v", now.Add(10*time.Second), s.Time(101))
+	}
+	for i, testcase := range []struct {
+		actual, expected float64
+	}{
+		{s.Get(now.Add(5*time.Second), key), 2},
+		{s.Sum(now, now.Add(15*time.Second), key), 3},
+		{s.Max(now, now.Add(30*time.Second), key), 2},
+		{s.Last(now.Add(29*time.Second), 10*time.Second, key), 2},
+		{s.Last(now.Add(29*time.Second), 20*time.Second, key), 4},
+	} {
+		if testcase.actual != testcase.expected {
+			t.Fatalf("%d: expect %v got %v", i, testcase.expected, testcase.actual)
+		}
+	}
+}
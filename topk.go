@@ -0,0 +1,284 @@
+package stats
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+
+	"h12.io/stats/binary"
+)
+
+type (
+	// SpaceSaving is a Sketcher that tracks the most frequent keys with the
+	// Space-Saving algorithm, using at most capacity counters. A count may be
+	// overestimated by at most its Error.
+	SpaceSaving struct {
+		capacity int32
+		index    map[string]int
+		entries  ssHeap
+	}
+	KeyCount struct {
+		Key   string
+		Count float64
+		Error float64
+	}
+	ssHeap struct {
+		a     []KeyCount
+		index map[string]int
+	}
+)
+
+func NewSpaceSaving(capacity int32) *SpaceSaving {
+	if capacity < 1 {
+		panic("capacity must be at least 1")
+	}
+	s := &SpaceSaving{capacity: capacity}
+	s.Reset()
+	return s
+}
+
+func NewSpaceSavingRingSketcher(ringSize int, capacity int32, startOffset int64) *RingSketcher {
+	a := make([]Sketcher, ringSize)
+	for i := range a {
+		a[i] = NewSpaceSaving(capacity)
+	}
+	return NewRingSketcher(startOffset, a, func() Sketcher { return &SpaceSaving{} })
+}
+
+func (s *SpaceSaving) Get(key []byte) float64 {
+	if i, ok := s.index[string(key)]; ok {
+		return s.entries.a[i].Count
+	}
+	return 0
+}
+
+func (s *SpaceSaving) Inc(key []byte) {
+	s.Add(key, 1)
+}
+
+func (s *SpaceSaving) Add(key []byte, n uint64) {
+	if n == 0 {
+		return
+	}
+	if i, ok := s.index[string(key)]; ok {
+		s.entries.a[i].Count += float64(n)
+		heap.Fix(&s.entries, i)
+		return
+	}
+	if len(s.entries.a) < int(s.capacity) {
+		heap.Push(&s.entries, KeyCount{Key: string(key), Count: float64(n)})
+		return
+	}
+	// replace the key with the minimum count
+	min := &s.entries.a[0]
+	delete(s.index, min.Key)
+	min.Key = string(key)
+	min.Error = min.Count
+	min.Count += float64(n)
+	s.index[min.Key] = 0
+	heap.Fix(&s.entries, 0)
+}
+
+// Diagnostics bounds the overestimate of a count by the minimum count once
+// the capacity is reached
+func (s *SpaceSaving) Diagnostics() Diagnostics {
+	d := Diagnostics{FillRatio: float64(len(s.entries.a)) / float64(s.capacity)}
+	for _, e := range s.entries.a {
+		d.Total += e.Count
+		d.MemoryBytes += int64(len(e.Key)) + mapEntryBytes + keyCountSize
+	}
+	if len(s.entries.a) >= int(s.capacity) {
+		d.ErrorBound = s.entries.a[0].Count
+	}
+	return d
+}
+
+func (s *SpaceSaving) Reset() {
+	s.index = make(map[string]int)
+	s.entries = ssHeap{index: s.index}
+}
+
+// Merge adds the entries of o and keeps the capacity entries with the
+// largest counts
+func (s *SpaceSaving) Merge(o Sketcher) error {
+	other, ok := o.(*SpaceSaving)
+	if !ok {
+		return fmt.Errorf("cannot merge %T into SpaceSaving", o)
+	}
+	a := sumKeyCounts([]*SpaceSaving{s, other})
+	s.Reset()
+	for _, e := range topKeyCounts(a, int(s.capacity)) {
+		heap.Push(&s.entries, e)
+	}
+	return nil
+}
+
+// Top returns at most n keys with the largest counts in descending order
+func (s *SpaceSaving) Top(n int) []KeyCount {
+	return topKeyCounts(append([]KeyCount(nil), s.entries.a...), n)
+}
+
+func topKeyCounts(a []KeyCount, n int) []KeyCount {
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Count != a[j].Count {
+			return a[i].Count > a[j].Count
+		}
+		return a[i].Key < a[j].Key
+	})
+	if len(a) > n {
+		a = a[:n]
+	}
+	return a
+}
+
+func (s *SpaceSaving) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.WriteInt32(s.capacity)
+	enc.WriteInt32(int32(len(s.entries.a)))
+	for _, e := range s.entries.a {
+		enc.WriteString(e.Key)
+		enc.WriteFloat64(e.Count)
+		enc.WriteFloat64(e.Error)
+	}
+	return enc.Flush()
+}
+
+func (s *SpaceSaving) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	s.capacity = dec.ReadInt32()
+	size := dec.ReadInt32()
+	if dec.Err() == nil && (s.capacity < 1 || size > s.capacity) {
+		dec.Fail(fmt.Errorf("%w: %d keys in capacity %d", binary.ErrCorrupt, size, s.capacity))
+	}
+	s.Reset()
+	for i := 0; i < int(size) && dec.Err() == nil; i++ {
+		e := KeyCount{Key: dec.ReadString(), Count: dec.ReadFloat64(), Error: dec.ReadFloat64()}
+		if dec.Err() != nil {
+			break
+		}
+		if _, ok := s.index[e.Key]; ok {
+			dec.Fail(fmt.Errorf("%w: duplicate key %q", binary.ErrCorrupt, e.Key))
+			break
+		}
+		heap.Push(&s.entries, e)
+	}
+	return dec.Result()
+}
+
+func (h *ssHeap) Len() int           { return len(h.a) }
+func (h *ssHeap) Less(i, j int) bool { return h.a[i].Count < h.a[j].Count }
+func (h *ssHeap) Swap(i, j int) {
+	h.a[i], h.a[j] = h.a[j], h.a[i]
+	h.index[h.a[i].Key] = i
+	h.index[h.a[j].Key] = j
+}
+func (h *ssHeap) Push(x interface{}) {
+	e := x.(KeyCount)
+	h.index[e.Key] = len(h.a)
+	h.a = append(h.a, e)
+}
+func (h *ssHeap) Pop() interface{} {
+	e := h.a[len(h.a)-1]
+	h.a = h.a[:len(h.a)-1]
+	delete(h.index, e.Key)
+	return e
+}
+
+// HeavyHitters feeds every Inc to both a RingSketcher for point queries and
+// a ring of SpaceSaving for top-k queries over a window of offsets
+type HeavyHitters struct {
+	*RingSketcher
+	top *RingSketcher
+}
+
+// NewHeavyHitters tracks at most capacity keys per offset along s
+func NewHeavyHitters(s *RingSketcher, capacity int32) *HeavyHitters {
+	return &HeavyHitters{
+		RingSketcher: s,
+		top:          NewSpaceSavingRingSketcher(s.Len(), capacity, s.Offset()),
+	}
+}
+
+func (h *HeavyHitters) Inc(offset int64, key []byte) {
+	h.RingSketcher.Inc(offset, key)
+	h.top.Inc(offset, key)
+}
+
+func (h *HeavyHitters) Add(offset int64, key []byte, n uint64) {
+	h.RingSketcher.Add(offset, key, n)
+	h.top.Add(offset, key, n)
+}
+
+// TopK returns at most k keys with the largest counts summed over the
+// offsets within [from, to]. A key missing from a full slot may still have
+// been counted up to the minimum count of the slot, which is added to both
+// its Count and Error, so that Count stays an overestimate by at most Error.
+func (h *HeavyHitters) TopK(k int, from, to int64) []KeyCount {
+	from, to = h.top.clip(from, to)
+	var slots []*SpaceSaving
+	for offset := from; offset <= to; offset++ {
+		if sk, ok := h.top.Sketcher(offset).(*SpaceSaving); ok {
+			slots = append(slots, sk)
+		}
+	}
+	return topKeyCounts(sumKeyCounts(slots), k)
+}
+
+// sumKeyCounts sums the counts of every key over the sketches. A full sketch
+// without the key may have evicted up to its minimum count of it, which is
+// added to both Count and Error, so that Count still overestimates by at most
+// Error.
+func sumKeyCounts(sketches []*SpaceSaving) []KeyCount {
+	sums := make(map[string]KeyCount)
+	for _, sk := range sketches {
+		for _, e := range sk.entries.a {
+			sum := sums[e.Key]
+			sum.Key = e.Key
+			sum.Count += e.Count
+			sum.Error += e.Error
+			sums[e.Key] = sum
+		}
+	}
+	for _, sk := range sketches {
+		if len(sk.entries.a) < int(sk.capacity) {
+			// every key of the sketch is tracked
+			continue
+		}
+		min := sk.entries.a[0].Count
+		for key, sum := range sums {
+			if _, ok := sk.index[key]; !ok {
+				sum.Count += min
+				sum.Error += min
+				sums[key] = sum
+			}
+		}
+	}
+	a := make([]KeyCount, 0, len(sums))
+	for _, e := range sums {
+		a = append(a, e)
+	}
+	return a
+}
+
+// Merge adds both rings of o into h
+func (h *HeavyHitters) Merge(o *HeavyHitters) error {
+	if err := h.RingSketcher.Merge(o.RingSketcher); err != nil {
+		return err
+	}
+	return h.top.Merge(o.top)
+}
+
+func (h *HeavyHitters) WriteTo(w io.Writer) (int64, error) {
+	enc := binary.NewEncoder(w)
+	enc.Encode(h.RingSketcher)
+	enc.Encode(h.top)
+	return enc.Flush()
+}
+
+func (h *HeavyHitters) ReadFrom(r io.Reader) (int64, error) {
+	dec := binary.NewDecoder(r)
+	dec.Decode(h.RingSketcher)
+	dec.Decode(h.top)
+	return dec.Result()
+}
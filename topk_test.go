@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := NewSpaceSaving(3)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			s.Inc([]byte(strconv.Itoa(i)))
+		}
+	}
+	top := s.Top(2)
+	if len(top) != 2 || top[0].Key != "9" || top[1].Key != "8" {
+		t.Fatalf("unexpected top %v", top)
+	}
+	for _, e := range top {
+		if actual, _ := strconv.Atoi(e.Key); e.Count-e.Error > float64(actual+1) || e.Count < float64(actual+1) {
+			t.Fatalf("count of %s out of bound: %v", e.Key, e)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var s2 SpaceSaving
+	if _, err := s2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s2.Top(3), s.Top(3)) {
+		t.Fatalf("expect %v got %v", s.Top(3), s2.Top(3))
+	}
+}
+
+func TestHeavyHitters(t *testing.T) {
+	h := NewHeavyHitters(NewMapRingSketcher(4, 1000, 0), 10)
+	for offset := int64(0); offset < 4; offset++ {
+		h.Inc(offset, []byte("a"))
+		for i := int64(0); i <= offset; i++ {
+			h.Inc(offset, []byte("b"))
+		}
+	}
+	h.Inc(0, []byte("c"))
+
+	top := h.TopK(2, 0, 3)
+	expected := []KeyCount{{Key: "b", Count: 10}, {Key: "a", Count: 4}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Fatalf("expect %v got %v", expected, top)
+	}
+	top = h.TopK(1, 0, 0)
+	expected = []KeyCount{{Key: "a", Count: 1}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Fatalf("expect %v got %v", expected, top)
+	}
+	if h.Get(3, []byte("b")) != 4 {
+		t.Fatal(h.Get(3, []byte("b")))
+	}
+
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	h2 := NewHeavyHitters(NewMapRingSketcher(4, 1000, 0), 10)
+	if _, err := h2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if top := h2.TopK(2, 0, 3); !reflect.DeepEqual(top, h.TopK(2, 0, 3)) {
+		t.Fatalf("expect %v got %v", h.TopK(2, 0, 3), top)
+	}
+}
+
+func TestHeavyHittersMissing(t *testing.T) {
+	h := NewHeavyHitters(NewMapRingSketcher(2, 10, 0), 1)
+	h.Add(0, []byte("a"), 2)
+	h.Add(1, []byte("b"), 3)
+	top := h.TopK(2, math.MinInt64, math.MaxInt64)
+	expected := []KeyCount{{Key: "a", Count: 5, Error: 3}, {Key: "b", Count: 5, Error: 2}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Fatalf("expect %v got %v", expected, top)
+	}
+}
+
+func TestSpaceSavingMergeBounds(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	truth := make(map[string]float64)
+	// the tails of the two streams are disjoint and evicted from the
+	// full sketches
+	newSketch := func(tail string) *SpaceSaving {
+		s := NewSpaceSaving(8)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(rnd.Intn(6))
+			if rnd.Intn(2) == 0 {
+				key = tail + strconv.Itoa(rnd.Intn(50))
+			}
+			s.Inc([]byte(key))
+			truth[key]++
+		}
+		return s
+	}
+	s, o := newSketch("s"), newSketch("o")
+	if err := s.Merge(o); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range s.Top(8) {
+		if actual := truth[e.Key]; e.Count-e.Error > actual || actual > e.Count {
+			t.Fatalf("%s: %v out of [%v, %v]", e.Key, actual, e.Count-e.Error, e.Count)
+		}
+	}
+}